@@ -0,0 +1,159 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+// The exit codes of cf query, besides 1 for invalid arguments.
+const (
+	queryErrorExitCode      = 2
+	assertionFailedExitCode = 3
+	noDataExitCode          = 4
+)
+
+// assertionOperators are the comparisons an assertion can make, longest
+// first so that "<=" is not read as "<".
+var assertionOperators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+// assertion is a condition that the value of every series, or of any series,
+// of the result of a query must meet.
+type assertion struct {
+	operator  string
+	threshold float64
+}
+
+// parseAssertions returns the assertions given by --assert and whether any
+// series meeting them is enough, as given by --assert-mode.
+func parseAssertions(opts queryOptionFlags, o queryOptions) ([]assertion, bool, error) {
+	if len(opts.Assert) == 0 {
+		if opts.AssertMode != "" {
+			return nil, false, errors.New("--assert-mode requires --assert")
+		}
+		return nil, false, nil
+	}
+
+	if o.rangeQuery || opts.Watch != 0 {
+		return nil, false, errors.New("--assert requires an instant query and cannot be used with --watch")
+	}
+
+	var anySeries bool
+	switch opts.AssertMode {
+	case "", "all":
+	case "any":
+		anySeries = true
+	default:
+		return nil, false, errors.New("--assert-mode must be one of any or all")
+	}
+
+	assertions := make([]assertion, 0, len(opts.Assert))
+	for _, a := range opts.Assert {
+		parsed, err := parseAssertion(a)
+		if err != nil {
+			return nil, false, err
+		}
+		assertions = append(assertions, parsed)
+	}
+	return assertions, anySeries, nil
+}
+
+func parseAssertion(a string) (assertion, error) {
+	a = strings.TrimSpace(a)
+	for _, op := range assertionOperators {
+		if !strings.HasPrefix(a, op) {
+			continue
+		}
+
+		threshold, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(a, op)), 64)
+		if err != nil {
+			break
+		}
+		return assertion{operator: op, threshold: threshold}, nil
+	}
+
+	return assertion{}, fmt.Errorf("invalid assertion '%s'. Ensure your assertion is a comparison with a number, such as '< 0.05'", a)
+}
+
+func (a assertion) String() string {
+	return a.operator + " " + strconv.FormatFloat(a.threshold, 'g', -1, 64)
+}
+
+// holds reports whether the value meets the assertion. Values that are not
+// numbers never do.
+func (a assertion) holds(v float64) bool {
+	switch a.operator {
+	case "<":
+		return v < a.threshold
+	case "<=":
+		return v <= a.threshold
+	case ">":
+		return v > a.threshold
+	case ">=":
+		return v >= a.threshold
+	case "==":
+		return v == a.threshold
+	case "!=":
+		return !math.IsNaN(v) && v != a.threshold
+	default:
+		return false
+	}
+}
+
+// checkAssertions checks the value of each series of the result of an
+// instant query against the assertions. Every series must meet them unless
+// anySeries is set, in which case one series is enough. It returns a report
+// of the outcome and the code to exit with, which is 0 if they are met.
+func checkAssertions(res *logcache.PromQLQueryResult, assertions []assertion, anySeries bool) ([]string, int) {
+	values, _ := resultValues(res)
+	if len(values) == 0 {
+		return []string{"Assertion failed: the query returned no data"}, noDataExitCode
+	}
+
+	descriptions := make([]string, 0, len(assertions))
+	for _, a := range assertions {
+		descriptions = append(descriptions, a.String())
+	}
+	condition := strings.Join(descriptions, " and ")
+
+	var failed []string
+	for _, v := range values {
+		if !meetsAll(v.value, assertions) {
+			name := v.key
+			if name == "" {
+				name = res.Data.ResultType
+			}
+			failed = append(failed, fmt.Sprintf("  %s = %s", name, v.value))
+		}
+	}
+
+	met := len(values) - len(failed)
+	switch {
+	case !anySeries && len(failed) > 0:
+		report := []string{fmt.Sprintf("Assertion failed: %d of %d series not %s", len(failed), len(values), condition)}
+		return append(report, failed...), assertionFailedExitCode
+	case anySeries && met == 0:
+		report := []string{fmt.Sprintf("Assertion failed: none of %d series %s", len(values), condition)}
+		return append(report, failed...), assertionFailedExitCode
+	default:
+		return []string{fmt.Sprintf("Assertion passed: %d of %d series %s", met, len(values), condition)}, 0
+	}
+}
+
+func meetsAll(value string, assertions []assertion) bool {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return false
+	}
+
+	for _, a := range assertions {
+		if !a.holds(v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	// defaultChartWidth is the width of charts, including their Y axis, when
+	// the width of the terminal is not known.
+	defaultChartWidth = 80
+
+	// chartHeight is the number of lines a chart is drawn on.
+	chartHeight = 8
+
+	// minChartColumns is the fewest columns a chart is drawn with.
+	minChartColumns = 10
+)
+
+// chartBlocks are the partial blocks that draw the top of a column, from one
+// to seven eighths of a line.
+var chartBlocks = []rune("▁▂▃▄▅▆▇")
+
+// writeQueryCharts draws a chart of each series of the result of a range
+// query.
+func writeQueryCharts(w io.Writer, res *logcache.PromQLQueryResult, width int) error {
+	if res.Data.ResultType != "matrix" {
+		return fmt.Errorf("expected a matrix to chart, got a %s", res.Data.ResultType)
+	}
+
+	var series []promqlSeries
+	if err := json.Unmarshal(res.Data.Result, &series); err != nil {
+		return err
+	}
+
+	writeCharts(w, series, width)
+	return nil
+}
+
+// writeCharts draws a chart of each series of a range matrix, with a legend
+// of its labels.
+func writeCharts(w io.Writer, series []promqlSeries, width int) {
+	for i, s := range series {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w, seriesLegend(s.Metric))
+		for _, line := range chartLines(s.Values, width) {
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// chartLines draws the points as columns that fit in the width. The Y axis is
+// scaled from the lowest to the highest value, and the X axis is labelled with
+// the times of the first and last points.
+func chartLines(points []promqlPoint, width int) []string {
+	values := make([]float64, 0, len(points))
+	var times []float64
+	for _, p := range points {
+		v, err := strconv.ParseFloat(p.value, 64)
+		if err != nil {
+			v = math.NaN()
+		}
+		values = append(values, v)
+		times = append(times, p.time)
+	}
+
+	lo, hi, ok := valueRange(values)
+	if !ok {
+		return []string{"No data"}
+	}
+
+	loLabel, hiLabel := formatChartValue(lo), formatChartValue(hi)
+	labelWidth := max(len(loLabel), len(hiLabel))
+
+	columns := chartColumns(values, width-labelWidth-2)
+
+	lines := make([]string, 0, chartHeight+2)
+	for row := 0; row < chartHeight; row++ {
+		label, axis := "", "│"
+		switch row {
+		case 0:
+			label, axis = hiLabel, "┤"
+		case chartHeight - 1:
+			label, axis = loLabel, "┤"
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "%*s %s", labelWidth, label, axis)
+		for _, v := range columns {
+			b.WriteRune(chartCell(v, lo, hi, chartHeight-1-row))
+		}
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+	}
+
+	pad := strings.Repeat(" ", labelWidth+1)
+	lines = append(lines, pad+"└"+strings.Repeat("─", len(columns)))
+	lines = append(lines, pad+" "+timeAxis(times[0], times[len(times)-1], len(columns)))
+
+	return lines
+}
+
+// chartColumns resamples the values to fit the given number of columns. When
+// there are fewer values than columns each is repeated over as many columns
+// as fit, otherwise each column is the mean of the values it covers.
+func chartColumns(values []float64, columns int) []float64 {
+	columns = max(columns, minChartColumns)
+	if len(values) <= columns {
+		repeat := columns / len(values)
+		stretched := make([]float64, 0, repeat*len(values))
+		for _, v := range values {
+			for i := 0; i < repeat; i++ {
+				stretched = append(stretched, v)
+			}
+		}
+		return stretched
+	}
+
+	resampled := make([]float64, columns)
+	for i := range resampled {
+		from, to := i*len(values)/columns, (i+1)*len(values)/columns
+
+		var sum float64
+		var n int
+		for _, v := range values[from:to] {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				sum += v
+				n++
+			}
+		}
+
+		resampled[i] = math.NaN()
+		if n > 0 {
+			resampled[i] = sum / float64(n)
+		}
+	}
+	return resampled
+}
+
+// chartCell returns the character drawn for a value on the given line,
+// counted from the bottom of the chart. The lowest value is drawn as an
+// eighth of a line so that it is still visible.
+func chartCell(v, lo, hi float64, line int) rune {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return ' '
+	}
+
+	eighths := 1 + int(math.Round((v-lo)/(hi-lo)*float64(chartHeight*8-1)))
+	fill := eighths - line*8
+	switch {
+	case fill >= 8:
+		return '█'
+	case fill <= 0:
+		return ' '
+	default:
+		return chartBlocks[fill-1]
+	}
+}
+
+// valueRange returns the lowest and highest finite values. If they are the
+// same the range is widened so that the values are drawn as full columns.
+func valueRange(values []float64) (float64, float64, bool) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+
+	if math.IsInf(lo, 1) {
+		return 0, 0, false
+	}
+
+	if lo == hi {
+		lo = hi - 1
+	}
+	return lo, hi, true
+}
+
+func formatChartValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 4, 64)
+}
+
+// timeAxis labels the first and last columns with their times. Times are
+// written with their date when the range is a day or longer.
+func timeAxis(first, last float64, columns int) string {
+	layout := "15:04:05"
+	if last-first >= (24 * time.Hour).Seconds() {
+		layout = "2006-01-02 15:04"
+	}
+
+	start := promqlPoint{time: first}.timeOf().Format(layout)
+	end := promqlPoint{time: last}.timeOf().Format(layout)
+	if columns < len(start)+len(end)+1 {
+		return start
+	}
+	return start + strings.Repeat(" ", columns-len(start)-len(end)) + end
+}
+
+// seriesLegend names a series by its labels, as PromQL selects it.
+func seriesLegend(metric map[string]string) string {
+	var labels []string
+	for name, value := range metric {
+		if name != "__name__" {
+			labels = append(labels, fmt.Sprintf("%s=%q", name, value))
+		}
+	}
+	sort.Strings(labels)
+
+	return metric["__name__"] + "{" + strings.Join(labels, ", ") + "}"
+}
@@ -0,0 +1,154 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// checkpointInterval is the most often a checkpoint file is written while
+// envelopes are being recorded.
+const checkpointInterval = time.Second
+
+// checkpoint records the timestamp of the last envelope written for each
+// source so that following can resume where it left off. It is persisted as
+// a JSON object mapping source IDs to UNIX nanosecond timestamps.
+type checkpoint struct {
+	path       string
+	timestamps map[string]int64
+	dirty      bool
+	lastSave   time.Time
+
+	// latest is the timestamp of the latest envelope read from each
+	// source, which is recorded once nothing before it is held.
+	latest map[string]int64
+}
+
+// loadCheckpoint reads the checkpoint file at path. A file that does not
+// exist yet is treated as an empty checkpoint.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{
+		path:       path,
+		timestamps: make(map[string]int64),
+		lastSave:   time.Now(),
+		latest:     make(map[string]int64),
+	}
+
+	data, err := os.ReadFile(path) //nolint:gosec // The path is given by the user.
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %s", path, err)
+	}
+
+	if err := json.Unmarshal(data, &c.timestamps); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint %s: %s", path, err)
+	}
+
+	return c, nil
+}
+
+// resume sets the walk start time of every checkpointed source to just after
+// its last written envelope and returns the sources that have not been
+// checkpointed.
+func (c *checkpoint) resume(sources []source, walkStartTimes map[string]int64) []source {
+	var unresumed []source
+	for _, s := range sources {
+		timestamp, ok := c.timestamps[s.id()]
+		if !ok {
+			unresumed = append(unresumed, s)
+			continue
+		}
+		walkStartTimes[s.id()] = timestamp + 1
+	}
+	return unresumed
+}
+
+// read notes that e has been read, to be recorded once it has been written
+// or dropped.
+func (c *checkpoint) read(e *loggregator_v2.Envelope) {
+	if e.GetTimestamp() > c.latest[e.GetSourceId()] {
+		c.latest[e.GetSourceId()] = e.GetTimestamp()
+	}
+}
+
+// recordSource notes that every envelope read from the source has been
+// written or dropped, except for any that are still held. held returns the
+// timestamp of the oldest envelope of a source that is still held, and
+// nothing from then on is recorded.
+func (c *checkpoint) recordSource(sourceID string, held func(sourceID string) (int64, bool)) {
+	timestamp := c.latest[sourceID]
+	if oldest, ok := held(sourceID); ok && oldest-1 < timestamp {
+		timestamp = oldest - 1
+	}
+
+	if timestamp > c.timestamps[sourceID] {
+		c.timestamps[sourceID] = timestamp
+		c.dirty = true
+	}
+}
+
+// record is like recordSource for every source that has been read from.
+func (c *checkpoint) record(held func(sourceID string) (int64, bool)) {
+	for sourceID := range c.latest {
+		c.recordSource(sourceID, held)
+	}
+}
+
+// due reports whether the checkpoint has not been saved within
+// checkpointInterval.
+func (c *checkpoint) due() bool {
+	return time.Since(c.lastSave) >= checkpointInterval
+}
+
+// older returns the timestamp of e if it is from the source and older than
+// the oldest found so far, or the oldest found so far.
+func older(e *loggregator_v2.Envelope, sourceID string, oldest int64, found bool) (int64, bool) {
+	if e.GetSourceId() == sourceID && (!found || e.GetTimestamp() < oldest) {
+		return e.GetTimestamp(), true
+	}
+	return oldest, found
+}
+
+// save writes the checkpoint file if anything has been recorded since it was
+// last written. The file is replaced atomically so that an interrupted save
+// does not corrupt it.
+func (c *checkpoint) save() error {
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c.timestamps)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), c.path); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	c.lastSave = time.Now()
+	return nil
+}
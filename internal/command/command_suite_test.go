@@ -54,10 +54,14 @@ type stubHTTPClient struct {
 	responseCount int
 	responseBody  []string
 	responseCode  int
-	responseErr   error
+	// pathResponseBody, if set, serves the responses for each path in order
+	// in place of responseBody.
+	pathResponseBody map[string][]string
+	responseErr      error
 
 	requestURLs    []string
 	requestHeaders []http.Header
+	infoRequests   int
 
 	serverVersion string
 }
@@ -75,6 +79,7 @@ func (s *stubHTTPClient) Do(r *http.Request) (*http.Response, error) {
 	defer s.mu.Unlock()
 
 	if r.URL.Path == "/api/v1/info" {
+		s.infoRequests++
 		return &http.Response{
 			StatusCode: http.StatusOK,
 			Body: io.NopCloser(strings.NewReader(
@@ -87,7 +92,12 @@ func (s *stubHTTPClient) Do(r *http.Request) (*http.Response, error) {
 	s.requestHeaders = append(s.requestHeaders, r.Header)
 
 	var body string
-	if s.responseCount < len(s.responseBody) {
+	if bodies, ok := s.pathResponseBody[r.URL.Path]; ok {
+		if len(bodies) > 0 {
+			body = bodies[0]
+			s.pathResponseBody[r.URL.Path] = bodies[1:]
+		}
+	} else if s.responseCount < len(s.responseBody) {
 		body = s.responseBody[s.responseCount]
 	}
 
@@ -126,8 +136,10 @@ type stubCliConnection struct {
 	usernameResp string
 	usernameErr  error
 	orgName      string
+	orgGUID      string
 	orgErr       error
 	spaceName    string
+	spaceGUID    string
 	spaceErr     error
 
 	accessTokenCount int
@@ -170,6 +182,7 @@ func (s *stubCliConnection) Username() (string, error) {
 func (s *stubCliConnection) GetCurrentOrg() (plugin_models.Organization, error) {
 	return plugin_models.Organization{
 		OrganizationFields: plugin_models.OrganizationFields{
+			Guid: s.orgGUID,
 			Name: s.orgName,
 		},
 	}, s.orgErr
@@ -178,6 +191,7 @@ func (s *stubCliConnection) GetCurrentOrg() (plugin_models.Organization, error)
 func (s *stubCliConnection) GetCurrentSpace() (plugin_models.Space, error) {
 	return plugin_models.Space{
 		SpaceFields: plugin_models.SpaceFields{
+			Guid: s.spaceGUID,
 			Name: s.spaceName,
 		},
 	}, s.spaceErr
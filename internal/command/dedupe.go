@@ -0,0 +1,124 @@
+package command
+
+import (
+	"bytes"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// defaultDedupeTimeout is how long a log is held while counting its repeats
+// by default.
+const defaultDedupeTimeout = 5 * time.Second
+
+// deduper collapses consecutive logs with the same payload from each source
+// instance into the first of them and a count of how many times it was
+// repeated. A log is held until a different one is read from its instance or,
+// while following, the timeout passes.
+type deduper struct {
+	timeout time.Duration
+	logs    map[string]*repeatedLog
+}
+
+// repeatedLog is a log and the number of times it has been read in a row.
+type repeatedLog struct {
+	envelope *loggregator_v2.Envelope
+	count    int
+	held     time.Time
+}
+
+// dedupeTimeout returns how long a log is held, given --dedupe-timeout.
+func dedupeTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return defaultDedupeTimeout
+	}
+	return timeout
+}
+
+func newDeduper(o tailOptions) *deduper {
+	return &deduper{
+		timeout: o.dedupeTimeout,
+		logs:    make(map[string]*repeatedLog),
+	}
+}
+
+// add passes e to visit unless it is a log, which is held until it is no
+// longer repeated. A held log that e is not a repeat of is passed to visit
+// first. So that envelopes are visited in timestamp order, every held log
+// older than an envelope that is visited is passed to visit before it.
+func (d *deduper) add(e *loggregator_v2.Envelope, visit func(*loggregator_v2.Envelope, int)) {
+	if e.GetLog() == nil {
+		d.flushBefore(e.GetTimestamp(), visit)
+		visit(e, 1)
+		return
+	}
+
+	key := e.GetSourceId() + "/" + e.GetInstanceId()
+	l, ok := d.logs[key]
+	if ok && repeats(l.envelope, e) {
+		l.count++
+		return
+	}
+
+	if ok {
+		delete(d.logs, key)
+		d.flushBefore(l.envelope.GetTimestamp(), visit)
+		visit(l.envelope, l.count)
+	}
+	d.logs[key] = &repeatedLog{envelope: e, count: 1, held: time.Now()}
+}
+
+// flushHeld passes every log that has been held for longer than the timeout
+// to visit.
+func (d *deduper) flushHeld(visit func(*loggregator_v2.Envelope, int)) {
+	d.expire(func(l *repeatedLog) bool {
+		return time.Since(l.held) >= d.timeout
+	}, visit)
+}
+
+// flushBefore passes every log held since the timestamp or before to visit.
+func (d *deduper) flushBefore(timestamp int64, visit func(*loggregator_v2.Envelope, int)) {
+	d.expire(func(l *repeatedLog) bool {
+		return l.envelope.GetTimestamp() <= timestamp
+	}, visit)
+}
+
+// flush passes every held log to visit.
+func (d *deduper) flush(visit func(*loggregator_v2.Envelope, int)) {
+	d.expire(func(*repeatedLog) bool { return true }, visit)
+}
+
+// expire passes the held logs that are done to visit in timestamp order.
+func (d *deduper) expire(done func(*repeatedLog) bool, visit func(*loggregator_v2.Envelope, int)) {
+	var expired []*loggregator_v2.Envelope
+	counts := make(map[*loggregator_v2.Envelope]int)
+	for key, l := range d.logs {
+		if done(l) {
+			expired = append(expired, l.envelope)
+			counts[l.envelope] = l.count
+			delete(d.logs, key)
+		}
+	}
+
+	sortByTimestamp(expired)
+	for _, e := range expired {
+		visit(e, counts[e])
+	}
+}
+
+// heldSince returns the timestamp of the oldest held log of the source, if
+// any are.
+func (d *deduper) heldSince(sourceID string) (int64, bool) {
+	var oldest int64
+	var found bool
+	for _, l := range d.logs {
+		oldest, found = older(l.envelope, sourceID, oldest, found)
+	}
+	return oldest, found
+}
+
+// repeats reports whether log e repeats the held log.
+func repeats(held, e *loggregator_v2.Envelope) bool {
+	return held.GetLog().GetType() == e.GetLog().GetType() &&
+		bytes.Equal(held.GetLog().GetPayload(), e.GetLog().GetPayload())
+}
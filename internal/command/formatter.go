@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -21,12 +22,29 @@ const (
 	prettyFormat formatterKind = iota
 	jsonFormat
 	templateFormat
+	logfmtFormat
+	csvFormat
+)
+
+// ANSI escape sequences used to colorize pretty output.
+const (
+	colorReset     = "\x1b[0m"
+	colorBold      = "\x1b[1m"
+	colorDim       = "\x1b[2m"
+	colorRed       = "\x1b[31m"
+	colorYellow    = "\x1b[33m"
+	colorCyan      = "\x1b[36m"
+	highlightStart = "\x1b[7m"
+	highlightEnd   = "\x1b[27m"
 )
 
 const (
 	appHeaderFormat     = "Retrieving logs for app %s in org %s / space %s as %s..."
 	serviceHeaderFormat = "Retrieving logs for service %s in org %s / space %s as %s..."
 	sourceHeaderFormat  = "Retrieving logs for source %s as %s..."
+	sourcesHeaderFormat = "Retrieving logs for sources %s in org %s / space %s as %s..."
+	spaceHeaderFormat   = "Retrieving logs for apps in org %s / space %s as %s..."
+	orgHeaderFormat     = "Retrieving logs for apps in org %s as %s..."
 )
 
 type formatterKind int
@@ -35,31 +53,65 @@ type formatter interface {
 	appHeader(app, org, space, user string) (string, bool)
 	serviceHeader(service, org, space, user string) (string, bool)
 	sourceHeader(sourceID, _, _, user string) (string, bool)
+	sourcesHeader(sources, org, space, user string) (string, bool)
+	spaceHeader(_, org, space, user string) (string, bool)
+	orgHeader(_, org, _, user string) (string, bool)
+	addSource(s source)
+	sourceName(e *loggregator_v2.Envelope) string
 	formatEnvelope(e *loggregator_v2.Envelope) (string, bool)
+	// formatRepeated formats a log that was read repeated times in a row.
+	formatRepeated(e *loggregator_v2.Envelope, repeated int) (string, bool)
 	flush() (string, bool)
 }
 
-func newFormatter(sourceID string, following bool, kind formatterKind, log Logger, t *template.Template, newLineReplacer rune) formatter {
+func newFormatter(o tailOptions, log Logger) formatter {
 	bf := baseFormatter{
-		log: log,
+		log:      log,
+		sources:  make(map[string]string, len(o.sources)),
+		appNames: o.scope != scopeSources,
+	}
+	for _, s := range o.sources {
+		bf.addSource(s)
 	}
 
-	switch kind {
+	switch formatterKindFromOptions(o) {
 	case prettyFormat:
-		return prettyFormatter{
+		f := prettyFormatter{
 			baseFormatter: bf,
-			sourceID:      sourceID,
-			newLine:       newLineReplacer,
+			newLine:       o.newLineReplacer,
+			timestamps:    o.timestamps(timeFormat),
+			fields:        o.fields,
+			color:         o.color && !o.noColor && o.outputFile == "",
 		}
+		if f.color {
+			f.highlight = o.grep
+		}
+		return f
 	case jsonFormat:
 		return &jsonFormatter{
-			following:     following,
+			streaming:     o.follow || o.jsonLines,
+			parseJSON:     o.parseJSON,
 			baseFormatter: bf,
 		}
 	case templateFormat:
 		return templateFormatter{
 			baseFormatter:  bf,
-			outputTemplate: t,
+			outputTemplate: o.outputTemplate,
+		}
+	case logfmtFormat:
+		return logfmtFormatter{
+			baseFormatter: bf,
+			newLine:       o.newLineReplacer,
+			timestamps:    o.timestamps(time.RFC3339Nano),
+			columns:       o.columns,
+		}
+	case csvFormat:
+		return &csvFormatter{
+			baseFormatter: bf,
+			newLine:       o.newLineReplacer,
+			timestamps:    o.timestamps(time.RFC3339Nano),
+			columns:       o.columns,
+			fileHeaders:   o.outputFile != "",
 		}
 	default:
 		log.Fatalf("Unknown formatter kind")
@@ -67,8 +119,47 @@ func newFormatter(sourceID string, following bool, kind formatterKind, log Logge
 	}
 }
 
+// outputFileHeader returns the line that starts every new or empty output file
+// written with f, if any.
+func outputFileHeader(f formatter) string {
+	if f, ok := f.(*csvFormatter); ok {
+		return f.fileHeader()
+	}
+	return ""
+}
+
 type baseFormatter struct {
 	log Logger
+
+	// sources maps the ID of every source being tailed to its name.
+	sources map[string]string
+	// appNames is set when every app in a space or org is being tailed.
+	appNames bool
+}
+
+func (f baseFormatter) addSource(s source) {
+	f.sources[s.id()] = s.Name
+}
+
+// multiSource reports whether envelopes from more than one source are being
+// formatted.
+func (f baseFormatter) multiSource() bool {
+	return f.appNames || len(f.sources) > 1
+}
+
+// sourceName returns the name the source of the envelope was requested by.
+func (f baseFormatter) sourceName(e *loggregator_v2.Envelope) string {
+	if name, ok := f.sources[e.GetSourceId()]; ok {
+		return name
+	}
+
+	if !f.multiSource() {
+		for _, name := range f.sources {
+			return name
+		}
+	}
+
+	return e.GetSourceId()
 }
 
 func (f baseFormatter) flush() (string, bool) {
@@ -87,14 +178,38 @@ func (f baseFormatter) sourceHeader(_, _, _, _ string) (string, bool) {
 	return "", false
 }
 
+func (f baseFormatter) sourcesHeader(_, _, _, _ string) (string, bool) {
+	return "", false
+}
+
+func (f baseFormatter) spaceHeader(_, _, _, _ string) (string, bool) {
+	return "", false
+}
+
+func (f baseFormatter) orgHeader(_, _, _, _ string) (string, bool) {
+	return "", false
+}
+
 func (f baseFormatter) formatEnvelope(e *loggregator_v2.Envelope) (string, bool) {
 	return "", false
 }
 
+func (f baseFormatter) formatRepeated(e *loggregator_v2.Envelope, repeated int) (string, bool) {
+	return "", false
+}
+
 type prettyFormatter struct {
 	baseFormatter
-	sourceID string
-	newLine  rune
+	newLine    rune
+	timestamps timestampFormat
+	// fields are the fields of JSON payloads that are written in place of
+	// the payload.
+	fields []string
+
+	// color is set when the output should be colorized, in which case any
+	// matches of highlight are highlighted.
+	color     bool
+	highlight *regexp.Regexp
 }
 
 func (f prettyFormatter) appHeader(app, org, space, user string) (string, bool) {
@@ -125,25 +240,81 @@ func (f prettyFormatter) sourceHeader(sourceID, _, _, user string) (string, bool
 	), true
 }
 
+func (f prettyFormatter) sourcesHeader(sources, org, space, user string) (string, bool) {
+	return fmt.Sprintf(
+		sourcesHeaderFormat,
+		sources,
+		org,
+		space,
+		user,
+	), true
+}
+
+func (f prettyFormatter) spaceHeader(_, org, space, user string) (string, bool) {
+	return fmt.Sprintf(
+		spaceHeaderFormat,
+		org,
+		space,
+		user,
+	), true
+}
+
+func (f prettyFormatter) orgHeader(_, org, _, user string) (string, bool) {
+	return fmt.Sprintf(
+		orgHeaderFormat,
+		org,
+		user,
+	), true
+}
+
 func (f prettyFormatter) formatEnvelope(e *loggregator_v2.Envelope) (string, bool) {
-	return envelopeWrapper{sourceID: f.sourceID, Envelope: e, newLine: f.newLine}.String(), true
+	return f.formatRepeated(e, 1)
+}
+
+func (f prettyFormatter) formatRepeated(e *loggregator_v2.Envelope, repeated int) (string, bool) {
+	return envelopeWrapper{
+		sourceID:   f.sourceName(e),
+		Envelope:   e,
+		newLine:    f.newLine,
+		timestamps: f.timestamps,
+		fields:     f.fields,
+		repeated:   repeated,
+		showSource: f.multiSource(),
+		appNames:   f.appNames,
+		color:      f.color,
+		highlight:  f.highlight,
+	}.String(), true
 }
 
 type jsonFormatter struct {
 	baseFormatter
 
-	following bool
+	// streaming is set when every envelope is written as a line of its own,
+	// rather than in a single batch when flushed.
+	streaming bool
+	// parseJSON is set when JSON payloads are written as objects rather than
+	// strings.
+	parseJSON bool
 	es        []string
 }
 
 func (f *jsonFormatter) formatEnvelope(e *loggregator_v2.Envelope) (string, bool) {
-	output, err := jsonEnvelope(e)
+	return f.formatRepeated(e, 1)
+}
+
+func (f *jsonFormatter) formatRepeated(e *loggregator_v2.Envelope, repeated int) (string, bool) {
+	o := jsonOptions{parseJSON: f.parseJSON, repeated: repeated}
+	if f.multiSource() {
+		o.sourceName = f.sourceName(e)
+	}
+
+	output, err := jsonEnvelope(e, o)
 	if err != nil {
 		log.Printf("failed to marshal envelope: %s", err)
 		return "", false
 	}
 
-	if !f.following {
+	if !f.streaming {
 		f.es = append(f.es, string(output))
 		return "", false
 	}
@@ -152,7 +323,7 @@ func (f *jsonFormatter) formatEnvelope(e *loggregator_v2.Envelope) (string, bool
 }
 
 func (f *jsonFormatter) flush() (string, bool) {
-	if f.following {
+	if f.streaming {
 		return "", false
 	}
 
@@ -164,36 +335,87 @@ func (f *jsonFormatter) flush() (string, bool) {
 type LogEnvelopeForMarshalling struct {
 	Timestamp      string            `json:"timestamp"`
 	SourceId       string            `json:"source_id"`
+	SourceName     string            `json:"source_name,omitempty"`
 	InstanceID     string            `json:"instance_id"`
 	DeprecatedTags map[string]string `json:"deprecated_tags,omitempty"`
 	Tags           map[string]string `json:"tags"`
 	Log            Log               `json:"log"`
+	Repeated       int               `json:"repeated,omitempty"`
 }
 
 type Log struct {
-	Payload string `json:"payload"`
+	// Payload is the payload as a string, or as a json.RawMessage when it
+	// is a JSON object that has been parsed.
+	Payload interface{} `json:"payload"`
+	Type    string      `json:"type"`
 }
 
-func jsonEnvelope(e *loggregator_v2.Envelope) ([]byte, error) {
+// jsonOptions are the optional parts of an envelope marshalled to JSON.
+type jsonOptions struct {
+	// sourceName is included as source_name when it is not empty.
+	sourceName string
+	// parseJSON is set when payloads that are JSON objects are included as
+	// objects.
+	parseJSON bool
+	// repeated is included for logs that were read more than once in a row.
+	repeated int
+}
+
+// jsonEnvelope marshals the envelope to JSON.
+func jsonEnvelope(e *loggregator_v2.Envelope, o jsonOptions) ([]byte, error) {
 	switch e.Message.(type) {
 	case *loggregator_v2.Envelope_Log:
 		depTags := map[string]string{}
 		for tag, value := range e.GetDeprecatedTags() {
 			depTags[tag] = value.String()
 		}
+		var payload interface{} = string(e.GetLog().GetPayload())
+		if raw, ok := rawJSONPayload(e); ok && o.parseJSON {
+			payload = raw
+		}
+
 		m := LogEnvelopeForMarshalling{
 			Timestamp:      strconv.FormatInt(e.GetTimestamp(), 10),
 			SourceId:       e.GetSourceId(),
+			SourceName:     o.sourceName,
 			InstanceID:     e.GetInstanceId(),
 			Tags:           e.GetTags(),
 			DeprecatedTags: depTags,
-			Log:            Log{Payload: string(e.GetLog().GetPayload())},
+			Log: Log{
+				Payload: payload,
+				Type:    e.GetLog().GetType().String(),
+			},
+		}
+		if o.repeated > 1 {
+			m.Repeated = o.repeated
 		}
 
 		return json.Marshal(m)
 	default:
-		return protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(e)
+		output, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(e)
+		if err != nil || o.sourceName == "" {
+			return output, err
+		}
+
+		return withSourceName(output, o.sourceName)
+	}
+}
+
+// withSourceName adds a source_name field to the start of a marshalled JSON
+// object.
+func withSourceName(object []byte, sourceName string) ([]byte, error) {
+	name, err := json.Marshal(sourceName)
+	if err != nil {
+		return nil, err
+	}
+
+	object = bytes.TrimSpace(object)
+	output := append([]byte(`{"source_name":`), name...)
+	if !bytes.Equal(object, []byte("{}")) {
+		output = append(output, ',')
 	}
+
+	return append(output, object[1:]...), nil
 }
 
 type templateFormatter struct {
@@ -202,6 +424,15 @@ type templateFormatter struct {
 	outputTemplate *template.Template
 }
 
+// templateEnvelope is the data passed to output templates. It exposes the
+// envelope's fields and methods along with the name of its source.
+type templateEnvelope struct {
+	*loggregator_v2.Envelope
+	SourceName string
+	// Repeated is the number of times a log was read in a row.
+	Repeated int
+}
+
 func (f templateFormatter) appHeader(app, org, space, user string) (string, bool) {
 	return fmt.Sprintf(
 		appHeaderFormat,
@@ -230,10 +461,43 @@ func (f templateFormatter) sourceHeader(sourceID, _, _, user string) (string, bo
 	), true
 }
 
+func (f templateFormatter) sourcesHeader(sources, org, space, user string) (string, bool) {
+	return fmt.Sprintf(
+		sourcesHeaderFormat,
+		sources,
+		org,
+		space,
+		user,
+	), true
+}
+
+func (f templateFormatter) spaceHeader(_, org, space, user string) (string, bool) {
+	return fmt.Sprintf(
+		spaceHeaderFormat,
+		org,
+		space,
+		user,
+	), true
+}
+
+func (f templateFormatter) orgHeader(_, org, _, user string) (string, bool) {
+	return fmt.Sprintf(
+		orgHeaderFormat,
+		org,
+		user,
+	), true
+}
+
 func (f templateFormatter) formatEnvelope(e *loggregator_v2.Envelope) (string, bool) {
+	return f.formatRepeated(e, 1)
+}
+
+func (f templateFormatter) formatRepeated(e *loggregator_v2.Envelope, repeated int) (string, bool) {
 	b := bytes.Buffer{}
-	if err := f.outputTemplate.Execute(&b, e); err != nil {
-		f.log.Fatalf("Output template parsed, but failed to execute: %s", err)
+	data := templateEnvelope{Envelope: e, SourceName: f.sourceName(e), Repeated: repeated}
+	if err := f.outputTemplate.Execute(&b, data); err != nil {
+		f.log.Printf("Output template failed to execute, skipping envelope: %s", err)
+		return "", false
 	}
 
 	if b.Len() == 0 {
@@ -245,37 +509,43 @@ func (f templateFormatter) formatEnvelope(e *loggregator_v2.Envelope) (string, b
 
 type envelopeWrapper struct {
 	*loggregator_v2.Envelope
-	sourceID string
-	newLine  rune
+	sourceID   string
+	newLine    rune
+	timestamps timestampFormat
+	fields     []string
+	// repeated is the number of times a log was read in a row.
+	repeated   int
+	showSource bool
+	appNames   bool
+	color      bool
+	highlight  *regexp.Regexp
 }
 
 func (e envelopeWrapper) String() string {
-	ts := time.Unix(0, e.Timestamp)
-
 	switch e.Message.(type) {
 	case *loggregator_v2.Envelope_Log:
-		payload := string(e.GetLog().GetPayload())
-		sanitizer := func(r rune) rune {
-			if r == e.newLine {
-				return '\n'
-			}
-			return r
-		}
-		if e.newLine != 0 {
-			payload = strings.Map(sanitizer, payload)
+		payload := logPayload(e.Envelope, e.newLine)
+		if fields, ok := selectedFields(e.Envelope, e.fields); ok {
+			payload = fields
 		}
 
-		return fmt.Sprintf("%s%s %s",
-			e.header(ts),
+		body := fmt.Sprintf("%s %s",
 			e.GetLog().GetType(),
-			payload,
+			e.highlighted(payload),
 		)
+		if e.GetLog().GetType() == loggregator_v2.Log_ERR {
+			body = e.paint(colorRed, body)
+		}
+		if e.repeated > 1 {
+			body += e.paint(colorDim, fmt.Sprintf(" (repeated %d times)", e.repeated))
+		}
+
+		return e.header() + body
 	case *loggregator_v2.Envelope_Counter:
-		return fmt.Sprintf("%sCOUNTER %s:%d",
-			e.header(ts),
+		return e.header() + e.paint(colorDim, fmt.Sprintf("COUNTER %s:%d",
 			e.GetCounter().GetName(),
 			e.GetCounter().GetTotal(),
-		)
+		))
 	case *loggregator_v2.Envelope_Gauge:
 		var values []string
 		for k, v := range e.GetGauge().GetMetrics() {
@@ -284,46 +554,65 @@ func (e envelopeWrapper) String() string {
 
 		sort.Strings(values)
 
-		return fmt.Sprintf("%sGAUGE %s",
-			e.header(ts),
+		return e.header() + e.paint(colorDim, fmt.Sprintf("GAUGE %s",
 			strings.Join(values, " "),
-		)
+		))
 	case *loggregator_v2.Envelope_Timer:
 		timer := e.GetTimer()
-		return fmt.Sprintf("%sTIMER %s %f ms",
-			e.header(ts),
+		return e.header() + e.paint(colorDim, fmt.Sprintf("TIMER %s %f ms",
 			timer.GetName(),
 			float64(timer.GetStop()-timer.GetStart())/1000000.0,
-		)
+		))
 	case *loggregator_v2.Envelope_Event:
-		return fmt.Sprintf("%sEVENT %s:%s",
-			e.header(ts),
-			e.GetEvent().GetTitle(),
-			e.GetEvent().GetBody(),
-		)
+		return e.header() + e.paint(colorYellow, fmt.Sprintf("EVENT %s:%s",
+			e.highlighted(e.GetEvent().GetTitle()),
+			e.highlighted(e.GetEvent().GetBody()),
+		))
 	default:
 		return e.Envelope.String()
 	}
 }
 
-func (e envelopeWrapper) header(ts time.Time) string {
-	if e.InstanceId == "" {
-		return fmt.Sprintf("   %s [%s] ",
-			ts.Format(timeFormat),
-			e.source(),
-		)
-	} else {
-		return fmt.Sprintf("   %s [%s/%s] ",
-			ts.Format(timeFormat),
-			e.source(),
-			e.GetInstanceId(),
-		)
+func (e envelopeWrapper) header() string {
+	source := e.source()
+	if e.InstanceId != "" {
+		source += "/" + e.GetInstanceId()
 	}
+
+	return fmt.Sprintf("   %s %s ",
+		e.paint(colorCyan, e.timestamps.format(e.GetTimestamp())),
+		e.paint(colorBold, "["+source+"]"),
+	)
+}
+
+// paint wraps s in the given color when the output is colorized.
+func (e envelopeWrapper) paint(color, s string) string {
+	if !e.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// highlighted highlights every match of the highlight pattern in s. The
+// highlight is ended without resetting the color of the rest of the line.
+func (e envelopeWrapper) highlighted(s string) string {
+	if e.highlight == nil {
+		return s
+	}
+	return e.highlight.ReplaceAllStringFunc(s, func(match string) string {
+		return highlightStart + match + highlightEnd
+	})
 }
 
 func (e envelopeWrapper) source() string {
 	switch e.Message.(type) {
 	case *loggregator_v2.Envelope_Log:
+		switch {
+		case e.appNames:
+			return e.sourceID
+		case e.showSource:
+			return e.sourceID + " " + e.sourceType()
+		}
 		return e.sourceType()
 	default:
 		return e.sourceID
@@ -331,14 +620,9 @@ func (e envelopeWrapper) source() string {
 }
 
 func (e envelopeWrapper) sourceType() string {
-	st, ok := e.Tags["source_type"]
+	st, ok := envelopeTag(e.Envelope, "source_type")
 	if !ok {
-		t, ok := e.DeprecatedTags["source_type"]
-		if !ok {
-			return "unknown"
-		}
-
-		return t.GetText()
+		return "unknown"
 	}
 
 	return st
@@ -0,0 +1,128 @@
+package command
+
+import (
+	"regexp"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// grepper filters envelopes by the text of their log payload or event. Like
+// grep -B and -A, it can also keep the envelopes before and after each match.
+// Metrics have no text, so they never match.
+type grepper struct {
+	pattern       *regexp.Regexp
+	invertPattern *regexp.Regexp
+	newLine       rune
+	before        int
+	after         int
+
+	// previous holds up to before envelopes since the last match.
+	previous []*loggregator_v2.Envelope
+	// remaining is how many more envelopes follow the last match.
+	remaining int
+}
+
+func newGrepper(o tailOptions) *grepper {
+	return &grepper{
+		pattern:       o.grep,
+		invertPattern: o.grepInvert,
+		newLine:       o.newLineReplacer,
+		before:        o.beforeContext,
+		after:         o.afterContext,
+	}
+}
+
+// filter passes e to visit if it matches. When it does, the envelopes before
+// it are passed to visit first. Envelopes that do not match are passed to
+// visit if they follow a recent match.
+func (g *grepper) filter(e *loggregator_v2.Envelope, visit func(*loggregator_v2.Envelope)) {
+	if g.matches(e) {
+		for _, p := range g.previous {
+			visit(p)
+		}
+		g.previous = g.previous[:0]
+		g.remaining = g.after
+		visit(e)
+		return
+	}
+
+	if g.remaining > 0 {
+		g.remaining--
+		visit(e)
+		return
+	}
+
+	if g.before == 0 {
+		return
+	}
+
+	if len(g.previous) == g.before {
+		copy(g.previous, g.previous[1:])
+		g.previous = g.previous[:len(g.previous)-1]
+	}
+	g.previous = append(g.previous, e)
+}
+
+// heldSince returns the timestamp of the oldest envelope of the source kept
+// in case it comes before a match, if any are.
+func (g *grepper) heldSince(sourceID string) (int64, bool) {
+	var oldest int64
+	var found bool
+	for _, e := range g.previous {
+		oldest, found = older(e, sourceID, oldest, found)
+	}
+	return oldest, found
+}
+
+func (g *grepper) matches(e *loggregator_v2.Envelope) bool {
+	text := envelopeText(e, g.newLine)
+
+	if g.pattern != nil && !matchesAny(g.pattern, text) {
+		return false
+	}
+
+	if g.invertPattern != nil && matchesAny(g.invertPattern, text) {
+		return false
+	}
+
+	return true
+}
+
+func matchesAny(pattern *regexp.Regexp, text []string) bool {
+	for _, t := range text {
+		if pattern.MatchString(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// envelopeText returns the text of a log or event envelope as it is written
+// by the pretty formatter.
+func envelopeText(e *loggregator_v2.Envelope, newLine rune) []string {
+	switch e.Message.(type) {
+	case *loggregator_v2.Envelope_Log:
+		return []string{logPayload(e, newLine)}
+	case *loggregator_v2.Envelope_Event:
+		return []string{e.GetEvent().GetTitle(), e.GetEvent().GetBody()}
+	default:
+		return nil
+	}
+}
+
+// logPayload returns the payload of a log envelope with every newLine
+// character replaced by a new line.
+func logPayload(e *loggregator_v2.Envelope, newLine rune) string {
+	payload := string(e.GetLog().GetPayload())
+	if newLine == 0 {
+		return payload
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r == newLine {
+			return '\n'
+		}
+		return r
+	}, payload)
+}
@@ -0,0 +1,130 @@
+package command
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// jsonPayload returns the fields of a log whose payload is a JSON object.
+// Numbers are kept as they were written.
+func jsonPayload(e *loggregator_v2.Envelope) (map[string]interface{}, bool) {
+	payload := bytes.TrimSpace(e.GetLog().GetPayload())
+	if len(payload) == 0 || payload[0] != '{' {
+		return nil, false
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, false
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, false
+	}
+
+	return fields, true
+}
+
+// rawJSONPayload returns the payload of a log as compact JSON if it is a JSON
+// object.
+func rawJSONPayload(e *loggregator_v2.Envelope) (json.RawMessage, bool) {
+	payload := bytes.TrimSpace(e.GetLog().GetPayload())
+	if len(payload) == 0 || payload[0] != '{' {
+		return nil, false
+	}
+
+	var b bytes.Buffer
+	if err := json.Compact(&b, payload); err != nil {
+		return nil, false
+	}
+
+	return b.Bytes(), true
+}
+
+// payloadField returns the value of a field of a JSON payload. Fields of
+// nested objects are named with dots, such as "http.status".
+func payloadField(fields map[string]interface{}, name string) (interface{}, bool) {
+	if v, ok := fields[name]; ok {
+		return v, true
+	}
+
+	parent, child, ok := strings.Cut(name, ".")
+	if !ok {
+		return nil, false
+	}
+
+	nested, ok := fields[parent].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	return payloadField(nested, child)
+}
+
+// formatField returns a field of a JSON payload as text. Strings are written
+// as they are and other values as JSON.
+func formatField(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// selectedFields returns the given fields of a log with a JSON payload as
+// key=value pairs. It returns false if the payload is not JSON or has none of
+// the fields.
+func selectedFields(e *loggregator_v2.Envelope, names []string) (string, bool) {
+	if len(names) == 0 {
+		return "", false
+	}
+
+	fields, ok := jsonPayload(e)
+	if !ok {
+		return "", false
+	}
+
+	var pairs []string
+	for _, name := range names {
+		if v, ok := payloadField(fields, name); ok {
+			pairs = append(pairs, name+"="+logfmtValue(formatField(v)))
+		}
+	}
+
+	if len(pairs) == 0 {
+		return "", false
+	}
+	return strings.Join(pairs, " "), true
+}
+
+// whereFilter only keeps logs with a JSON payload whose fields have the values
+// given by --where.
+func whereFilter(e *loggregator_v2.Envelope, o tailOptions) bool {
+	if len(o.where) == 0 {
+		return true
+	}
+
+	fields, ok := jsonPayload(e)
+	if !ok {
+		return false
+	}
+
+	for name, value := range o.where {
+		if v, ok := payloadField(fields, name); !ok || formatField(v) != value {
+			return false
+		}
+	}
+
+	return true
+}
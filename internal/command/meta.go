@@ -46,7 +46,12 @@ type source struct {
 }
 
 type sourceInfo struct {
-	Resources []source `json:"resources"`
+	Resources  []source `json:"resources"`
+	Pagination struct {
+		Next *struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"pagination"`
 }
 
 type serviceInstance struct {
@@ -220,13 +225,7 @@ func createLogCacheClient(c http.Client, log Logger, cli plugin.CliConnection) *
 		log.Fatalf("Could not determine Log Cache endpoint: %s", err)
 	}
 
-	c = http.NewTokenClient(c, func() string {
-		token, err := cli.AccessToken()
-		if err != nil {
-			log.Fatalf("Unable to get Access Token: %s", err)
-		}
-		return token
-	})
+	c = http.NewTokenClient(c, cli.AccessToken)
 
 	return logcache.NewClient(
 		logCacheEndpoint,
@@ -0,0 +1,184 @@
+package command
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// defaultMultilineTimeout is how long a multi-line record waits for
+	// more lines by default.
+	defaultMultilineTimeout = time.Second
+
+	// maxMultilineLines is the most lines stitched into a single record.
+	maxMultilineLines = 1000
+)
+
+// continuationPattern matches the lines that continue a record by default:
+// indented lines and the "at", "Caused by" and "... n more" lines of stack
+// traces.
+var continuationPattern = regexp.MustCompile(`^(\s|at\s|Caused by\b|\.\.\.\s)`)
+
+// stitcher groups the logs of each source instance and log type that continue
+// a record, such as the lines of a stack trace, into a single log. A record is
+// written once a log that starts a new record is read, or once no more lines
+// have been read for it within the timeout.
+type stitcher struct {
+	start   *regexp.Regexp
+	timeout time.Duration
+
+	records map[string]*multilineRecord
+}
+
+// multilineRecord is a log waiting for more lines.
+type multilineRecord struct {
+	envelope *loggregator_v2.Envelope
+	lines    [][]byte
+	// last is the timestamp of the last line and updated is when it was
+	// read.
+	last    int64
+	updated time.Time
+}
+
+func newStitcher(o tailOptions) *stitcher {
+	return &stitcher{
+		start:   o.multilineStart,
+		timeout: o.multilineTimeout,
+		records: make(map[string]*multilineRecord),
+	}
+}
+
+// add passes e to visit unless it is a log that may be continued. Records
+// that e shows to be complete are passed to visit first.
+func (s *stitcher) add(e *loggregator_v2.Envelope, visit func(*loggregator_v2.Envelope)) {
+	s.expire(func(r *multilineRecord) bool {
+		return e.GetTimestamp()-r.last > s.timeout.Nanoseconds()
+	}, visit)
+
+	if e.GetLog() == nil {
+		s.flushBefore(e.GetTimestamp(), visit)
+		visit(e)
+		return
+	}
+
+	key := e.GetSourceId() + "/" + e.GetInstanceId() + "/" + e.GetLog().GetType().String()
+	r, ok := s.records[key]
+	if ok && !s.startsRecord(e.GetLog().GetPayload()) && len(r.lines) < maxMultilineLines {
+		r.lines = append(r.lines, e.GetLog().GetPayload())
+		r.last = e.GetTimestamp()
+		r.updated = time.Now()
+		return
+	}
+
+	if ok {
+		delete(s.records, key)
+		s.flushBefore(r.envelope.GetTimestamp(), visit)
+		visit(r.stitched())
+	}
+
+	s.records[key] = &multilineRecord{
+		envelope: e,
+		lines:    [][]byte{e.GetLog().GetPayload()},
+		last:     e.GetTimestamp(),
+		updated:  time.Now(),
+	}
+}
+
+// flushIdle passes every record that has not been added to within the
+// timeout to visit.
+func (s *stitcher) flushIdle(visit func(*loggregator_v2.Envelope)) {
+	s.expire(func(r *multilineRecord) bool {
+		return time.Since(r.updated) > s.timeout
+	}, visit)
+}
+
+// flushBefore passes every record started at the timestamp or before to
+// visit.
+func (s *stitcher) flushBefore(timestamp int64, visit func(*loggregator_v2.Envelope)) {
+	s.expire(func(r *multilineRecord) bool {
+		return r.envelope.GetTimestamp() <= timestamp
+	}, visit)
+}
+
+// flush passes every record to visit.
+func (s *stitcher) flush(visit func(*loggregator_v2.Envelope)) {
+	s.expire(func(*multilineRecord) bool { return true }, visit)
+}
+
+// expire passes the records that are done to visit in timestamp order.
+func (s *stitcher) expire(done func(*multilineRecord) bool, visit func(*loggregator_v2.Envelope)) {
+	var expired []*loggregator_v2.Envelope
+	for key, r := range s.records {
+		if done(r) {
+			expired = append(expired, r.stitched())
+			delete(s.records, key)
+		}
+	}
+
+	sortByTimestamp(expired)
+	for _, e := range expired {
+		visit(e)
+	}
+}
+
+// heldSince returns the timestamp of the oldest record of the source waiting
+// for more lines, if any are.
+func (s *stitcher) heldSince(sourceID string) (int64, bool) {
+	var oldest int64
+	var found bool
+	for _, r := range s.records {
+		oldest, found = older(r.envelope, sourceID, oldest, found)
+	}
+	return oldest, found
+}
+
+func (s *stitcher) startsRecord(line []byte) bool {
+	if s.start != nil {
+		return s.start.Match(line)
+	}
+	return !continuationPattern.Match(line)
+}
+
+// stitched returns the first log of the record with the payload of every
+// line joined by new lines.
+func (r *multilineRecord) stitched() *loggregator_v2.Envelope {
+	if len(r.lines) == 1 {
+		return r.envelope
+	}
+
+	e := proto.Clone(r.envelope).(*loggregator_v2.Envelope)
+	e.GetLog().Payload = bytes.Join(r.lines, []byte("\n"))
+	return e
+}
+
+// parseMultiline returns the pattern that starts a record and how long a
+// record waits for more lines.
+func parseMultiline(opts tailOptionFlags) (*regexp.Regexp, time.Duration, error) {
+	if !opts.Multiline {
+		if opts.MultilineStart != "" || opts.MultilineTimeout != 0 {
+			return nil, 0, errors.New("--multiline-start and --multiline-timeout require --multiline")
+		}
+		return nil, 0, nil
+	}
+
+	timeout := opts.MultilineTimeout
+	if timeout <= 0 {
+		timeout = defaultMultilineTimeout
+	}
+
+	if opts.MultilineStart == "" {
+		return nil, timeout, nil
+	}
+
+	start, err := regexp.Compile(opts.MultilineStart)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid multiline start pattern '%s'. Ensure your pattern is a valid regex", opts.MultilineStart)
+	}
+	return start, timeout, nil
+}
@@ -0,0 +1,292 @@
+package command
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotatedTimeFormat is the format of the timestamp appended to the path of
+// rotated files.
+const rotatedTimeFormat = "20060102T150405.000000000"
+
+// outputFiles writes envelopes to rotating files. When more than one source is
+// tailed, the envelopes of each source are written to their own file. Every
+// new or empty file starts with header.
+type outputFiles struct {
+	path      string
+	perSource bool
+	maxSize   int64
+	interval  time.Duration
+	gzip      bool
+	header    string
+	log       Logger
+
+	files map[string]*rotatingFile
+}
+
+// newOutputFiles opens the file at the path given by --output-file, or checks
+// that its directory exists when each source is written to its own file, so
+// that a path that cannot be written to is reported before tailing starts.
+func newOutputFiles(o tailOptions, header string, log Logger) (*outputFiles, error) {
+	f := &outputFiles{
+		path:      o.outputFile,
+		perSource: o.filePerSource(),
+		maxSize:   o.maxFileSize,
+		interval:  o.rotateInterval,
+		gzip:      o.gzipRotated,
+		header:    header,
+		log:       log,
+		files:     make(map[string]*rotatingFile),
+	}
+
+	if f.perSource {
+		dir := filepath.Dir(f.path)
+		info, err := os.Stat(dir)
+		if err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a directory", dir)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open output file: %s", err)
+		}
+		return f, nil
+	}
+
+	if err := f.file(f.path).open(); err != nil {
+		return nil, fmt.Errorf("failed to open output file: %s", err)
+	}
+	return f, nil
+}
+
+// writer returns a writer for the file that envelopes from the named source
+// are written to. Output that is not from a single source is written to the
+// file at the given path by passing an empty name.
+func (f *outputFiles) writer(sourceName string) *lineWriter {
+	path := f.path
+	if f.perSource && sourceName != "" {
+		path = sourcePath(f.path, sourceName)
+	}
+
+	return &lineWriter{w: f.file(path)}
+}
+
+func (f *outputFiles) file(path string) *rotatingFile {
+	file, ok := f.files[path]
+	if !ok {
+		file = &rotatingFile{
+			path:     path,
+			maxSize:  f.maxSize,
+			interval: f.interval,
+			gzip:     f.gzip,
+			header:   []byte(f.header),
+			log:      f.log,
+		}
+		f.files[path] = file
+	}
+	return file
+}
+
+// Flush writes any buffered output to every file.
+func (f *outputFiles) Flush() {
+	for _, file := range f.files {
+		file.Flush()
+	}
+}
+
+// Close flushes and closes every file.
+func (f *outputFiles) Close() error {
+	var errs []error
+	for _, file := range f.files {
+		errs = append(errs, file.Close())
+	}
+	return errors.Join(errs...)
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// sourcePath inserts the name of a source before the extension of path, so
+// that "out.log" becomes "out.app-name.log".
+func sourcePath(path, sourceName string) string {
+	ext := filepath.Ext(path)
+	name := unsafePathChars.ReplaceAllString(sourceName, "_")
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
+
+// rotatingFile is a file that is rotated once it would grow beyond maxSize
+// bytes or has been written to for longer than interval. Rotated files are
+// renamed with the time they were rotated appended to their path and, if gzip
+// is set, compressed. The file is opened by the first write. Writes to a new or
+// empty file are preceded by header. Failures to write are reported to log,
+// once until a write succeeds again.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	interval time.Duration
+	gzip     bool
+	header   []byte
+	log      Logger
+
+	failing bool
+
+	f      *os.File
+	w      *bufio.Writer
+	size   int64
+	opened time.Time
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	n, err := r.write(p)
+	r.report(err)
+	return n, err
+}
+
+func (r *rotatingFile) write(p []byte) (int, error) {
+	if r.f != nil && r.due(len(p)) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.size == 0 && len(r.header) > 0 {
+		n, err := r.w.Write(r.header)
+		r.size += int64(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.w.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Flush writes any buffered output to the file.
+func (r *rotatingFile) Flush() {
+	if r.f != nil {
+		r.report(r.w.Flush())
+	}
+}
+
+func (r *rotatingFile) report(err error) {
+	if err == nil {
+		r.failing = false
+		return
+	}
+
+	if !r.failing && r.log != nil {
+		r.log.Printf("Failed to write output file %s: %s", r.path, err)
+	}
+	r.failing = true
+}
+
+// Close flushes any buffered output and closes the file.
+func (r *rotatingFile) Close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	err := errors.Join(r.w.Flush(), r.f.Close())
+	r.f = nil
+	return err
+}
+
+func (r *rotatingFile) due(n int) bool {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+
+	return r.interval > 0 && time.Since(r.opened) >= r.interval
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) //nolint:gosec // The path is given by the user.
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	r.f = f
+	r.w = bufio.NewWriter(f)
+	r.size = info.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	rotated := r.path + "." + time.Now().Format(rotatedTimeFormat)
+	if err := os.Rename(r.path, rotated); err != nil {
+		return err
+	}
+
+	if r.gzip {
+		return compressFile(rotated)
+	}
+	return nil
+}
+
+// compressFile replaces the file at path with a gzipped copy at path.gz.
+func compressFile(path string) error {
+	src, err := os.Open(path) //nolint:gosec // The path is given by the user.
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600) //nolint:gosec // The path is given by the user.
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err = errors.Join(err, zw.Close(), dst.Close()); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// parseFileSize parses a size in bytes with an optional K, M or G suffix, e.g.
+// "100M".
+func parseFileSize(s string) (int64, error) {
+	size := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+
+	multiplier := int64(1)
+	for i, unit := range []string{"K", "M", "G"} {
+		if strings.HasSuffix(size, unit) {
+			multiplier = 1 << (10 * (i + 1))
+			size = strings.TrimSuffix(size, unit)
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid file size: %s", s)
+	}
+
+	return n * multiplier, nil
+}
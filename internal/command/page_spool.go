@@ -0,0 +1,160 @@
+package command
+
+import (
+	"container/heap"
+	"errors"
+	"os"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// pageSpool holds pages of envelopes in a temporary file so that pages read
+// newest first can be visited oldest first without holding them all in
+// memory.
+type pageSpool struct {
+	f     *os.File
+	pages []spooledPage
+	size  int64
+}
+
+// spooledPage is where a page is in the spool file.
+type spooledPage struct {
+	offset int64
+	size   int
+}
+
+func newPageSpool() (*pageSpool, error) {
+	f, err := os.CreateTemp("", "cf-tail-*")
+	if err != nil {
+		return nil, err
+	}
+	return &pageSpool{f: f}, nil
+}
+
+// add writes a page to the end of the spool.
+func (s *pageSpool) add(page []*loggregator_v2.Envelope) error {
+	data, err := proto.Marshal(&loggregator_v2.EnvelopeBatch{Batch: page})
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.f.Write(data); err != nil {
+		return err
+	}
+
+	s.pages = append(s.pages, spooledPage{offset: s.size, size: len(data)})
+	s.size += int64(len(data))
+	return nil
+}
+
+// spoolCursor reads the envelopes of a spool in the reverse of the order they
+// were added, last page first and last envelope first, holding one page at a
+// time.
+type spoolCursor struct {
+	spool *pageSpool
+	// page is the index of the next page to read.
+	page  int
+	batch []*loggregator_v2.Envelope
+}
+
+func (s *pageSpool) cursor() *spoolCursor {
+	return &spoolCursor{spool: s, page: len(s.pages) - 1}
+}
+
+// next returns the next envelope, or nil once there are none left.
+func (c *spoolCursor) next() (*loggregator_v2.Envelope, error) {
+	for len(c.batch) == 0 {
+		if c.page < 0 {
+			return nil, nil
+		}
+
+		p := c.spool.pages[c.page]
+		c.page--
+
+		data := make([]byte, p.size)
+		if _, err := c.spool.f.ReadAt(data, p.offset); err != nil {
+			return nil, err
+		}
+
+		var page loggregator_v2.EnvelopeBatch
+		if err := proto.Unmarshal(data, &page); err != nil {
+			return nil, err
+		}
+		c.batch = page.Batch
+	}
+
+	e := c.batch[len(c.batch)-1]
+	c.batch = c.batch[:len(c.batch)-1]
+	return e, nil
+}
+
+// mergeSpools passes the envelopes of every spool to visit, replaying each in
+// the reverse of the order they were added and merging them by timestamp.
+// Envelopes with the same timestamp are visited in the order of their spools.
+func mergeSpools(spools []*pageSpool, visit func(*loggregator_v2.Envelope)) error {
+	var h spoolHeap
+	for i, s := range spools {
+		c := s.cursor()
+		e, err := c.next()
+		if err != nil {
+			return err
+		}
+		if e != nil {
+			h = append(h, spoolHead{envelope: e, cursor: c, order: i})
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		visit(h[0].envelope)
+
+		e, err := h[0].cursor.next()
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			heap.Pop(&h)
+			continue
+		}
+		h[0].envelope = e
+		heap.Fix(&h, 0)
+	}
+	return nil
+}
+
+// spoolHead is the next envelope of a spool being merged.
+type spoolHead struct {
+	envelope *loggregator_v2.Envelope
+	cursor   *spoolCursor
+	order    int
+}
+
+// spoolHeap orders the next envelopes of the spools being merged by
+// timestamp.
+type spoolHeap []spoolHead
+
+func (h spoolHeap) Len() int { return len(h) }
+
+func (h spoolHeap) Less(i, j int) bool {
+	if h[i].envelope.GetTimestamp() != h[j].envelope.GetTimestamp() {
+		return h[i].envelope.GetTimestamp() < h[j].envelope.GetTimestamp()
+	}
+	return h[i].order < h[j].order
+}
+
+func (h spoolHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *spoolHeap) Push(x any) { *h = append(*h, x.(spoolHead)) }
+
+func (h *spoolHeap) Pop() any {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
+
+// Close closes and removes the spool file.
+func (s *pageSpool) Close() error {
+	return errors.Join(s.f.Close(), os.Remove(s.f.Name()))
+}
@@ -6,7 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"strconv"
+	"os"
 	"strings"
 	"time"
 
@@ -19,7 +19,39 @@ import (
 
 type QueryOption func(*queryOptions)
 
+// WithQueryTable makes table output the default rather than JSON.
+func WithQueryTable() QueryOption {
+	return func(o *queryOptions) {
+		o.defaultOutput = tableQueryOutput
+	}
+}
+
+// WithQueryChartWidth sets the width that --chart draws charts in, such as
+// the width of the terminal.
+func WithQueryChartWidth(width int) QueryOption {
+	return func(o *queryOptions) {
+		o.chartWidth = width
+	}
+}
+
+// WithQueryRedraw makes --watch redraw each result in place of the last,
+// such as on a terminal, rather than writing it after the last.
+func WithQueryRedraw() QueryOption {
+	return func(o *queryOptions) {
+		o.redraw = true
+	}
+}
+
+// WithQueryExit sets how cf query exits with a code other than 0, which is
+// os.Exit by default.
+func WithQueryExit(exit func(code int)) QueryOption {
+	return func(o *queryOptions) {
+		o.exit = exit
+	}
+}
+
 func Query(
+	ctx context.Context,
 	cli plugin.CliConnection,
 	args []string,
 	c http.Client,
@@ -30,26 +62,24 @@ func Query(
 	if len(args) < 1 {
 		log.Fatalf("Must specify a PromQL query")
 	}
-	query := args[0]
-
 	queryOptions, err := newQueryOptions(cli, args, log)
 	if err != nil {
 		log.Fatalf("%s", err)
 	}
 
+	query, sourceNames, err := resolveSourceNames(args[0], cli, log)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	if queryOptions.relabelSources {
+		queryOptions.sourceNames = sourceNames
+	}
+
 	for _, opt := range opts {
 		opt(&queryOptions)
 	}
 
-	lw := lineWriter{w: w}
-
-	c = http.NewTokenClient(c, func() string {
-		token, err := cli.AccessToken()
-		if err != nil {
-			log.Fatalf("Unable to get Access Token: %s", err)
-		}
-		return token
-	})
+	c = http.NewTokenClient(c, cli.AccessToken)
 
 	hasAPI, err := cli.HasAPIEndpoint()
 	if err != nil {
@@ -69,42 +99,92 @@ func Query(
 
 	client := logcache.NewClient(logCacheAddr, logcache.WithHTTPClient(c))
 
-	var res *logcache.PromQLQueryResult
+	if queryOptions.watch > 0 {
+		watchQuery(ctx, client, query, queryOptions, w, log)
+		return
+	}
 
-	if !queryOptions.rangeQuery {
-		var options []logcache.PromQLOption
+	res, err := runQuery(ctx, client, query, queryOptions)
+	if message, failed := queryFailure(res, err); failed {
+		log.Printf("%s", message)
+		queryOptions.exit(queryErrorExitCode)
+		return
+	}
+
+	writeQueryResult(w, res, queryOptions, log)
 
-		if queryOptions.timeProvided {
-			options = append(options, logcache.WithPromQLTime(queryOptions.time))
+	if len(queryOptions.assertions) > 0 {
+		report, code := checkAssertions(res, queryOptions.assertions, queryOptions.assertAny)
+		for _, line := range report {
+			log.Printf("%s", line)
 		}
+		if code != 0 {
+			queryOptions.exit(code)
+		}
+	}
+}
 
-		res, err = client.PromQLRaw(
-			context.Background(),
-			query,
-			options...,
-		)
-	} else {
+// runQuery issues an instant or a range query, and relabels the sources of
+// the result with their names when asked to.
+func runQuery(ctx context.Context, client *logcache.Client, query string, o queryOptions) (*logcache.PromQLQueryResult, error) {
+	var res *logcache.PromQLQueryResult
+	var err error
+	if o.rangeQuery {
 		res, err = client.PromQLRangeRaw(
-			context.Background(),
+			ctx,
 			query,
-			logcache.WithPromQLStart(queryOptions.start),
-			logcache.WithPromQLEnd(queryOptions.end),
-			logcache.WithPromQLStep(queryOptions.step),
+			logcache.WithPromQLStart(o.start),
+			logcache.WithPromQLEnd(o.end),
+			logcache.WithPromQLStep(o.step),
 		)
+	} else {
+		var options []logcache.PromQLOption
+		if o.timeProvided {
+			options = append(options, logcache.WithPromQLTime(o.time))
+		}
+		res, err = client.PromQLRaw(ctx, query, options...)
 	}
 
+	if err != nil || res == nil || res.Status == "error" {
+		return res, err
+	}
+	return res, relabelSources(res, o.sourceNames)
+}
+
+// queryFailure returns why a query failed, either to be issued or because
+// Log Cache returned an error.
+func queryFailure(res *logcache.PromQLQueryResult, err error) (string, bool) {
 	if err != nil {
-		lw.Write(fmt.Sprintf("Could not process query: %s", err.Error()))
-		return
+		return fmt.Sprintf("Could not process query: %s", err.Error()), true
 	}
 
 	if res != nil && res.Status == "error" {
-		lw.Write(fmt.Sprintf("The PromQL API returned an error (%s): %s", res.ErrorType, res.Error))
+		return fmt.Sprintf("The PromQL API returned an error (%s): %s", res.ErrorType, res.Error), true
+	}
+
+	return "", false
+}
+
+// writeQueryResult writes the result of a query.
+func writeQueryResult(w io.Writer, res *logcache.PromQLQueryResult, o queryOptions, log Logger) {
+	lw := lineWriter{w: w}
+
+	if o.chart {
+		if err := writeQueryCharts(w, res, o.chartWidth); err != nil {
+			log.Fatalf("Could not chart query result: %s", err)
+		}
+		return
+	}
+
+	if o.outputFormat() == jsonQueryOutput {
+		body, _ := json.Marshal(res)
+		lw.Write(string(body))
 		return
 	}
 
-	body, _ := json.Marshal(res)
-	lw.Write(string(body))
+	if err := writeQueryTable(w, res, o.outputFormat() == longQueryOutput); err != nil {
+		log.Fatalf("Could not write query result: %s", err)
+	}
 }
 
 type queryOptions struct {
@@ -114,13 +194,57 @@ type queryOptions struct {
 	step         string
 	rangeQuery   bool
 	timeProvided bool
+
+	// output is the format given by --output, or defaultOutput if there is
+	// none.
+	output        string
+	defaultOutput string
+
+	chart      bool
+	chartWidth int
+
+	// watch is how often an instant query is issued again, or 0 to issue it
+	// once.
+	watch  time.Duration
+	redraw bool
+
+	// assertions are met by the value of every series, or of any series when
+	// assertAny is set.
+	assertions []assertion
+	assertAny  bool
+
+	// sourceNames are the names of the apps and services named in the query
+	// keyed by their GUIDs, which replace the GUIDs in the result when
+	// relabelSources is set.
+	sourceNames    map[string]string
+	relabelSources bool
+
+	exit func(code int)
+}
+
+// outputFormat returns the format the result is written in.
+func (o queryOptions) outputFormat() string {
+	switch {
+	case o.output != "":
+		return o.output
+	case o.defaultOutput != "":
+		return o.defaultOutput
+	default:
+		return jsonQueryOutput
+	}
 }
 
 type queryOptionFlags struct {
-	Time  string `long:"time"`
-	Start string `long:"start"`
-	End   string `long:"end"`
-	Step  string `long:"step"`
+	Time           timeArgument  `long:"time"`
+	Start          timeArgument  `long:"start"`
+	End            timeArgument  `long:"end"`
+	Step           string        `long:"step"`
+	Output         string        `long:"output"`
+	Chart          bool          `long:"chart"`
+	Watch          time.Duration `long:"watch"`
+	Assert         []string      `long:"assert"`
+	AssertMode     string        `long:"assert-mode"`
+	RelabelSources bool          `long:"relabel-sources"`
 }
 
 func newQueryOptions(cli plugin.CliConnection, args []string, log Logger) (queryOptions, error) {
@@ -135,6 +259,54 @@ func newQueryOptions(cli plugin.CliConnection, args []string, log Logger) (query
 		return queryOptions{}, fmt.Errorf("expected 1 argument, got %d", len(args))
 	}
 
+	switch opts.Output {
+	case "", tableQueryOutput, longQueryOutput, jsonQueryOutput:
+	default:
+		return queryOptions{}, errors.New("--output must be one of table, long or json")
+	}
+
+	if opts.Chart && opts.Output != "" {
+		return queryOptions{}, errors.New("--chart cannot be used with --output")
+	}
+
+	if opts.Watch < 0 {
+		return queryOptions{}, errors.New("--watch must be a positive duration")
+	}
+
+	if opts.Watch != 0 && opts.Time != "" {
+		return queryOptions{}, errors.New("--watch cannot be used with --time")
+	}
+
+	o, err := parseQueryTimes(opts)
+	if err != nil {
+		return queryOptions{}, err
+	}
+
+	if opts.Chart && !o.rangeQuery {
+		return queryOptions{}, errors.New("--chart requires a range query with --start, --end and --step")
+	}
+
+	if opts.Watch != 0 && o.rangeQuery {
+		return queryOptions{}, errors.New("--watch requires an instant query")
+	}
+
+	o.assertions, o.assertAny, err = parseAssertions(opts, o)
+	if err != nil {
+		return queryOptions{}, err
+	}
+
+	o.output = opts.Output
+	o.watch = opts.Watch
+	o.exit = os.Exit
+	o.chart = opts.Chart
+	o.relabelSources = opts.RelabelSources
+	o.chartWidth = defaultChartWidth
+	return o, nil
+}
+
+// parseQueryTimes returns the time of an instant query or the range of a
+// range query.
+func parseQueryTimes(opts queryOptionFlags) (queryOptions, error) {
 	if isInstantQuery(opts) && !validInstantQueryArgs(opts) {
 		return queryOptions{}, errors.New("when issuing an instant query, you cannot specify --start, --end, or --step")
 	}
@@ -143,12 +315,14 @@ func newQueryOptions(cli plugin.CliConnection, args []string, log Logger) (query
 		return queryOptions{}, errors.New("when issuing a range query, you must specify all of --start, --end, and --step")
 	}
 
+	now := time.Now()
+
 	if isInstantQuery(opts) {
 		if opts.Time == "" {
 			return queryOptions{}, nil
 		}
 
-		parsedTime, err := getParsedTime(opts.Time)
+		parsedTime, err := parseTime(opts.Time, now, time.Second)
 		if err != nil {
 			return queryOptions{}, fmt.Errorf("couldn't parse --time: %s", err.Error())
 		}
@@ -157,11 +331,11 @@ func newQueryOptions(cli plugin.CliConnection, args []string, log Logger) (query
 	}
 
 	if isRangeQuery(opts) {
-		parsedStart, err := getParsedTime(opts.Start)
+		parsedStart, err := parseTime(opts.Start, now, time.Second)
 		if err != nil {
 			return queryOptions{}, fmt.Errorf("couldn't parse --start: %s", err.Error())
 		}
-		parsedEnd, err := getParsedTime(opts.End)
+		parsedEnd, err := parseTime(opts.End, now, time.Second)
 		if err != nil {
 			return queryOptions{}, fmt.Errorf("couldn't parse --end: %s", err.Error())
 		}
@@ -172,17 +346,6 @@ func newQueryOptions(cli plugin.CliConnection, args []string, log Logger) (query
 	return queryOptions{}, nil
 }
 
-func getParsedTime(inputTime string) (time.Time, error) {
-	if t, err := strconv.Atoi(inputTime); err == nil {
-		return time.Unix(int64(t), 0), nil
-	}
-	if parsedTime, err := time.Parse(time.RFC3339, inputTime); err == nil {
-		return parsedTime, nil
-	}
-
-	return time.Time{}, fmt.Errorf("invalid time format: %s", inputTime)
-}
-
 func isInstantQuery(opts queryOptionFlags) bool {
 	return opts.Time != "" || (opts.Start == "" && opts.End == "" && opts.Step == "")
 }
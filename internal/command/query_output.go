@@ -0,0 +1,208 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+const (
+	tableQueryOutput = "table"
+	longQueryOutput  = "long"
+	jsonQueryOutput  = "json"
+)
+
+// promqlPoint is a value at a time, given by the PromQL API as a pair of a
+// UNIX timestamp in seconds and a string.
+type promqlPoint struct {
+	time  float64
+	value string
+}
+
+func (p *promqlPoint) UnmarshalJSON(b []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(b, &pair); err != nil {
+		return err
+	}
+
+	if len(pair) != 2 {
+		return fmt.Errorf("expected a timestamp and a value, got %d elements", len(pair))
+	}
+
+	if err := json.Unmarshal(pair[0], &p.time); err != nil {
+		return err
+	}
+	return json.Unmarshal(pair[1], &p.value)
+}
+
+func (p promqlPoint) timeOf() time.Time {
+	sec, frac := math.Modf(p.time)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// formatTime returns the time of the point in RFC3339.
+func (p promqlPoint) formatTime() string {
+	return p.timeOf().Format(time.RFC3339)
+}
+
+// promqlSeries is a series of an instant vector, with a single value, or of a
+// range matrix, with a value for each step.
+type promqlSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  promqlPoint       `json:"value"`
+	Values []promqlPoint     `json:"values"`
+}
+
+// writeQueryTable writes the result of a query as a table. Scalars and
+// strings are written as they are. Instant vectors have a row for each series
+// with a column for each label and its value. Range matrices have a row for
+// each series with a column for each step, or a row for each value when long
+// is set.
+func writeQueryTable(w io.Writer, res *logcache.PromQLQueryResult, long bool) error {
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+
+	switch res.Data.ResultType {
+	case "scalar", "string":
+		var p promqlPoint
+		if err := json.Unmarshal(res.Data.Result, &p); err != nil {
+			return err
+		}
+		fmt.Fprintln(tw, p.value)
+	case "vector":
+		var series []promqlSeries
+		if err := json.Unmarshal(res.Data.Result, &series); err != nil {
+			return err
+		}
+		writeVectorTable(tw, series, long)
+	case "matrix":
+		var series []promqlSeries
+		if err := json.Unmarshal(res.Data.Result, &series); err != nil {
+			return err
+		}
+		if long {
+			writeLongMatrixTable(tw, series)
+		} else {
+			writeMatrixTable(tw, series)
+		}
+	default:
+		return fmt.Errorf("unknown result type %q", res.Data.ResultType)
+	}
+
+	return tw.Flush()
+}
+
+func writeVectorTable(tw io.Writer, series []promqlSeries, long bool) {
+	if len(series) == 0 {
+		return
+	}
+
+	labels := labelNames(series)
+	header := labels
+	if long {
+		header = append(header, "Time")
+	}
+	writeRow(tw, append(header, "Value"))
+
+	for _, s := range series {
+		row := labelValues(s, labels)
+		if long {
+			row = append(row, s.Value.formatTime())
+		}
+		writeRow(tw, append(row, s.Value.value))
+	}
+}
+
+func writeMatrixTable(tw io.Writer, series []promqlSeries) {
+	if len(series) == 0 {
+		return
+	}
+
+	var times []float64
+	seen := make(map[float64]bool)
+	for _, s := range series {
+		for _, p := range s.Values {
+			if !seen[p.time] {
+				seen[p.time] = true
+				times = append(times, p.time)
+			}
+		}
+	}
+	sort.Float64s(times)
+
+	labels := labelNames(series)
+	header := labels
+	for _, t := range times {
+		header = append(header, promqlPoint{time: t}.formatTime())
+	}
+	writeRow(tw, header)
+
+	for _, s := range series {
+		values := make(map[float64]string, len(s.Values))
+		for _, p := range s.Values {
+			values[p.time] = p.value
+		}
+
+		row := labelValues(s, labels)
+		for _, t := range times {
+			row = append(row, values[t])
+		}
+		writeRow(tw, row)
+	}
+}
+
+func writeLongMatrixTable(tw io.Writer, series []promqlSeries) {
+	if len(series) == 0 {
+		return
+	}
+
+	labels := labelNames(series)
+	writeRow(tw, append(labels, "Time", "Value"))
+
+	for _, s := range series {
+		for _, p := range s.Values {
+			writeRow(tw, append(labelValues(s, labels), p.formatTime(), p.value))
+		}
+	}
+}
+
+func writeRow(tw io.Writer, cells []string) {
+	fmt.Fprintln(tw, strings.Join(cells, "\t"))
+}
+
+// labelNames returns the names of the labels of every series, with the metric
+// name first and the rest sorted.
+func labelNames(series []promqlSeries) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, s := range series {
+		for name := range s.Metric {
+			if !seen[name] && name != "__name__" {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, s := range series {
+		if _, ok := s.Metric["__name__"]; ok {
+			return append([]string{"__name__"}, names...)
+		}
+	}
+	return names
+}
+
+func labelValues(s promqlSeries, labels []string) []string {
+	values := make([]string, 0, len(labels))
+	for _, name := range labels {
+		values = append(values, s.Metric[name])
+	}
+	return values
+}
@@ -0,0 +1,134 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"code.cloudfoundry.org/cli/plugin"
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+var (
+	// sourceSelectorPattern matches a source_id selector that names an app
+	// or service rather than giving its GUID, such as source_id="app:my-app".
+	sourceSelectorPattern = regexp.MustCompile(`(source_id\s*!?=\s*)(?:"(app|service):([^"]+)"|'(app|service):([^']+)')`)
+
+	// sourcePlaceholderPattern matches a placeholder for the GUID of an app
+	// or service, such as {{app "my-app"}}.
+	sourcePlaceholderPattern = regexp.MustCompile(`\{\{\s*(app|service)\s+(?:"([^"]+)"|'([^']+)')\s*\}\}`)
+)
+
+// sourceResolver looks up the GUIDs of the apps and services named in a
+// query, looking up each only once.
+type sourceResolver struct {
+	cli plugin.CliConnection
+	log Logger
+
+	guids map[string]string
+	names map[string]string
+	err   error
+}
+
+// resolveSourceNames replaces the apps and services named in the source_id
+// selectors of a query, such as source_id="app:my-app", and in placeholders,
+// such as {{app "my-app"}}, with their GUIDs. It returns the query and the
+// names of the apps and services keyed by their GUIDs.
+func resolveSourceNames(query string, cli plugin.CliConnection, log Logger) (string, map[string]string, error) {
+	r := sourceResolver{
+		cli:   cli,
+		log:   log,
+		guids: make(map[string]string),
+		names: make(map[string]string),
+	}
+
+	query = sourceSelectorPattern.ReplaceAllStringFunc(query, func(selector string) string {
+		m := sourceSelectorPattern.FindStringSubmatch(selector)
+		kind, name, quote := m[2], m[3], `"`
+		if kind == "" {
+			kind, name, quote = m[4], m[5], "'"
+		}
+		return m[1] + quote + r.guid(kind, name) + quote
+	})
+
+	query = sourcePlaceholderPattern.ReplaceAllStringFunc(query, func(placeholder string) string {
+		m := sourcePlaceholderPattern.FindStringSubmatch(placeholder)
+		name := m[2]
+		if name == "" {
+			name = m[3]
+		}
+		return r.guid(m[1], name)
+	})
+
+	if r.err != nil {
+		return "", nil, r.err
+	}
+	return query, r.names, nil
+}
+
+// guid returns the GUID of the app or service with the given name, using the
+// same lookups as cf tail.
+func (r *sourceResolver) guid(kind, name string) string {
+	key := kind + ":" + name
+	if guid, ok := r.guids[key]; ok {
+		return guid
+	}
+
+	var guid string
+	switch kind {
+	case "app":
+		guid = getAppGUID(name, r.cli, r.log)
+	case "service":
+		guid = getServiceGUID(name, r.cli, r.log)
+	}
+
+	if guid == "" {
+		if r.err == nil {
+			r.err = fmt.Errorf("could not find %s '%s' in the targeted space", kind, name)
+		}
+		return ""
+	}
+
+	r.guids[key] = guid
+	r.names[guid] = name
+	return guid
+}
+
+// relabelSources replaces the GUIDs in the source_id labels of the series of
+// a result with the names of the apps and services they belong to.
+func relabelSources(res *logcache.PromQLQueryResult, names map[string]string) error {
+	if len(names) == 0 || (res.Data.ResultType != "vector" && res.Data.ResultType != "matrix") {
+		return nil
+	}
+
+	var series []map[string]json.RawMessage
+	if err := json.Unmarshal(res.Data.Result, &series); err != nil {
+		return err
+	}
+
+	for _, s := range series {
+		var metric map[string]string
+		if err := json.Unmarshal(s["metric"], &metric); err != nil {
+			return err
+		}
+
+		name, ok := names[metric["source_id"]]
+		if !ok {
+			continue
+		}
+		metric["source_id"] = name
+
+		relabelled, err := json.Marshal(metric)
+		if err != nil {
+			return err
+		}
+		s["metric"] = relabelled
+	}
+
+	result, err := json.Marshal(series)
+	if err != nil {
+		return err
+	}
+	res.Data.Result = result
+	return nil
+}
@@ -1,8 +1,13 @@
 package command_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"code.cloudfoundry.org/log-cache-cli/v4/internal/command"
 	. "github.com/onsi/ginkgo/v2"
@@ -16,9 +21,11 @@ var _ = Describe("LogCache", func() {
 
 			tc.query(`placeholder-for-a-query`)
 
-			Expect(tc.writer.lines()).To(Equal([]string{
+			Expect(tc.logger.printfMessages).To(Equal([]string{
 				"Could not process query: unexpected status code 503",
 			}))
+			Expect(tc.writer.bytes).To(BeEmpty())
+			Expect(tc.exitCode).To(Equal(2))
 		})
 
 		It("reports an error for a failed request", func() {
@@ -26,9 +33,11 @@ var _ = Describe("LogCache", func() {
 
 			tc.query(`placeholder-for-a-query`)
 
-			Expect(tc.writer.lines()).To(Equal([]string{
+			Expect(tc.logger.printfMessages).To(Equal([]string{
 				"Could not process query: unexpected end of JSON input (status code 500)",
 			}))
+			Expect(tc.writer.bytes).To(BeEmpty())
+			Expect(tc.exitCode).To(Equal(2))
 		})
 
 		It("reports the returned error message for an invalid PromQL query", func() {
@@ -37,9 +46,11 @@ var _ = Describe("LogCache", func() {
 
 			tc.query(`not-a-valid-query`)
 
-			Expect(tc.writer.lines()).To(Equal([]string{
+			Expect(tc.logger.printfMessages).To(Equal([]string{
 				"The PromQL API returned an error (bad_data): query does not request any source_ids",
 			}))
+			Expect(tc.writer.bytes).To(BeEmpty())
+			Expect(tc.exitCode).To(Equal(2))
 		})
 
 		It("hints at authorization failures when receiving a 404", func() {
@@ -47,9 +58,11 @@ var _ = Describe("LogCache", func() {
 
 			tc.query(`not-a-valid-query`)
 
-			Expect(tc.writer.lines()).To(Equal([]string{
+			Expect(tc.logger.printfMessages).To(Equal([]string{
 				"Could not process query: unexpected status code 404 (check authorization?)",
 			}))
+			Expect(tc.writer.bytes).To(BeEmpty())
+			Expect(tc.exitCode).To(Equal(2))
 		})
 
 		It("exits with an error when no query is provided", func() {
@@ -141,8 +154,23 @@ var _ = Describe("LogCache", func() {
 				},
 				Entry("with a valid integer", "123456789"),
 				Entry("with a valid RFC3339 timestamp", "2018-02-23T19:00:00Z"),
+				Entry("with now", "now"),
+				Entry("with a relative time", "-1h30m"),
 			)
 
+			It("resolves relative times against now", func() {
+				tc := setup("", 200)
+
+				tc.query(`egress{source_id="doppler"}`, "--time", "-1h")
+				Expect(tc.httpClient.requestURLs).To(HaveLen(1))
+
+				requestURL, err := url.Parse(tc.httpClient.requestURLs[0])
+				Expect(err).ToNot(HaveOccurred())
+				t, err := strconv.ParseFloat(requestURL.Query().Get("time"), 64)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(t).To(BeNumerically("~", time.Now().Add(-time.Hour).Unix(), 2))
+			})
+
 			DescribeTable("with invalid times",
 				func(timeArg string) {
 					tc := setup("", 200)
@@ -205,6 +233,7 @@ var _ = Describe("LogCache", func() {
 				Entry("with a valid integer timestamps", "123456789", "987654321", "15s"),
 				Entry("with a valid RFC3339 timestamps", "2018-02-23T19:00:00Z", "2018-08-23T19:00:00Z", "1m"),
 				Entry("with mixed timestamps", "123456789", "2018-08-23T19:00:00Z", "1m"),
+				Entry("with relative timestamps", "-1h", "now", "1m"),
 			)
 
 			DescribeTable("with invalid times",
@@ -241,13 +270,445 @@ var _ = Describe("LogCache", func() {
 			)
 		})
 	})
+
+	Describe("writing results as a table", func() {
+		It("writes an instant vector with a row for each series", func() {
+			json := `{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"__name__":"cpu","source_id":"app-a","instance_id":"0"},"value":[1580231000,"12.5"]},` +
+				`{"metric":{"__name__":"cpu","source_id":"app-a","instance_id":"1"},"value":[1580231000,"3"]}]}}`
+			tc := setup(json, 200)
+
+			tc.query(`cpu{source_id="app-a"}`, "--output", "table")
+
+			Expect(tc.writer.lines()).To(Equal([]string{
+				"__name__  instance_id  source_id  Value",
+				"cpu       0            app-a      12.5",
+				"cpu       1            app-a      3",
+			}))
+		})
+
+		It("writes scalars plainly", func() {
+			json := `{"status":"success","data":{"resultType":"scalar","result":[1580231000,"2.5"]}}`
+			tc := setup(json, 200)
+
+			tc.query(`scalar(1)`, "--output", "table")
+
+			Expect(tc.writer.lines()).To(Equal([]string{"2.5"}))
+		})
+
+		It("writes a range matrix with a column for each step", func() {
+			json := `{"status":"success","data":{"resultType":"matrix","result":[` +
+				`{"metric":{"instance_id":"0"},"values":[[1580231000,"1"],[1580231060,"2"]]},` +
+				`{"metric":{"instance_id":"1"},"values":[[1580231060,"4"]]}]}}`
+			tc := setup(json, 200)
+
+			tc.query(`cpu{source_id="app-a"}`, "--start", "1580231000", "--end", "1580231060", "--step", "1m", "--output", "table")
+
+			first := time.Unix(1580231000, 0).Format(time.RFC3339)
+			second := time.Unix(1580231060, 0).Format(time.RFC3339)
+			Expect(tc.writer.lines()).To(Equal([]string{
+				fmt.Sprintf("instance_id  %s  %s", first, second),
+				fmt.Sprintf("0            1%s  2", strings.Repeat(" ", len(first)-1)),
+				fmt.Sprintf("1            %s  4", strings.Repeat(" ", len(first))),
+			}))
+		})
+
+		It("writes a range matrix with a row for each value in long format", func() {
+			json := `{"status":"success","data":{"resultType":"matrix","result":[` +
+				`{"metric":{"instance_id":"0"},"values":[[1580231000,"1"],[1580231060,"2"]]}]}}`
+			tc := setup(json, 200)
+
+			tc.query(`cpu{source_id="app-a"}`, "--start", "1580231000", "--end", "1580231060", "--step", "1m", "--output", "long")
+
+			first := time.Unix(1580231000, 0).Format(time.RFC3339)
+			second := time.Unix(1580231060, 0).Format(time.RFC3339)
+			pad := strings.Repeat(" ", len(first)-len("Time"))
+			Expect(tc.writer.lines()).To(Equal([]string{
+				"instance_id  Time" + pad + "  Value",
+				fmt.Sprintf("0            %s  1", first),
+				fmt.Sprintf("0            %s  2", second),
+			}))
+		})
+
+		It("writes tables by default when WithQueryTable is given", func() {
+			json := `{"status":"success","data":{"resultType":"scalar","result":[1580231000,"2.5"]}}`
+			tc := setup(json, 200)
+
+			tc.queryWithOptions([]command.QueryOption{command.WithQueryTable()}, `scalar(1)`)
+
+			Expect(tc.writer.lines()).To(Equal([]string{"2.5"}))
+		})
+
+		It("writes JSON when --output json is given", func() {
+			json := `{"status":"success","data":{"resultType":"scalar","result":[1580231000,"2.5"]}}`
+			tc := setup(json, 200)
+
+			tc.queryWithOptions([]command.QueryOption{command.WithQueryTable()}, `scalar(1)`, "--output", "json")
+
+			Expect(tc.writer.lines()).To(Equal([]string{json}))
+		})
+
+		It("gives you an error for an unknown output format", func() {
+			tc := setup("", 200)
+
+			Expect(func() {
+				tc.query(`scalar(1)`, "--output", "yaml")
+			}).To(Panic())
+
+			Expect(tc.logger.fatalfMessage).To(Equal("--output must be one of table, long or json"))
+		})
+	})
+
+	Describe("drawing charts", func() {
+		It("draws a chart of each series of a range query", func() {
+			json := `{"status":"success","data":{"resultType":"matrix","result":[` +
+				`{"metric":{"__name__":"cpu","instance_id":"0"},"values":[[1580231000,"0"],[1580231060,"1"]]},` +
+				`{"metric":{"__name__":"cpu","instance_id":"1"},"values":[[1580231000,"5"],[1580231060,"5"]]}]}}`
+			tc := setup(json, 200)
+
+			tc.queryWithOptions(
+				[]command.QueryOption{command.WithQueryChartWidth(24)},
+				`cpu{source_id="app-a"}`, "--start", "1580231000", "--end", "1580231060", "--step", "1m", "--chart",
+			)
+
+			start := time.Unix(1580231000, 0).Format("15:04:05")
+			end := time.Unix(1580231060, 0).Format("15:04:05")
+			half := strings.Repeat("█", 10)
+			full := strings.Repeat("█", 20)
+			Expect(tc.writer.lines()).To(Equal([]string{
+				`cpu{instance_id="0"}`,
+				"1 ┤          " + half,
+				"  │          " + half,
+				"  │          " + half,
+				"  │          " + half,
+				"  │          " + half,
+				"  │          " + half,
+				"  │          " + half,
+				"0 ┤" + strings.Repeat("▁", 10) + half,
+				"  └" + strings.Repeat("─", 20),
+				"   " + start + "    " + end,
+				"",
+				`cpu{instance_id="1"}`,
+				"5 ┤" + full,
+				"  │" + full,
+				"  │" + full,
+				"  │" + full,
+				"  │" + full,
+				"  │" + full,
+				"  │" + full,
+				"4 ┤" + full,
+				"  └" + strings.Repeat("─", 20),
+				"   " + start + "    " + end,
+			}))
+		})
+
+		It("gives you an error if --chart is used with an instant query", func() {
+			tc := setup("", 200)
+
+			Expect(func() {
+				tc.query(`cpu{source_id="app-a"}`, "--chart")
+			}).To(Panic())
+
+			Expect(tc.logger.fatalfMessage).To(Equal("--chart requires a range query with --start, --end and --step"))
+		})
+
+		It("gives you an error if --chart is used with --output", func() {
+			tc := setup("", 200)
+
+			Expect(func() {
+				tc.query(`cpu{source_id="app-a"}`, "--start", "-1h", "--end", "now", "--step", "1m", "--chart", "--output", "json")
+			}).To(Panic())
+
+			Expect(tc.logger.fatalfMessage).To(Equal("--chart cannot be used with --output"))
+		})
+	})
+
+	Describe("watching a query", func() {
+		vector := func(value string) string {
+			return `{"status":"success","data":{"resultType":"vector","result":[` +
+				`{"metric":{"__name__":"cpu","instance_id":"0"},"value":[1580231000,"` + value + `"]}]}}`
+		}
+
+		It("writes each result after the last with the time it was issued", func() {
+			tc := setup(vector("1"), 200)
+			tc.httpClient.responseBody = []string{vector("1"), vector("2"), vector("2"), vector("2")}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+			tc.ctx = ctx
+			tc.query(`cpu{source_id="app-a"}`, "--watch", "100ms", "--output", "table")
+
+			Expect(tc.httpClient.requestCount()).To(BeNumerically(">=", 2))
+			lines := tc.writer.lines()
+			Expect(lines[0]).To(MatchRegexp(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`))
+			Expect(lines[1:4]).To(Equal([]string{
+				"__name__  instance_id  Value",
+				"cpu       0            1",
+				"",
+			}))
+			Expect(lines[4]).To(MatchRegexp(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`))
+			Expect(lines[6]).To(Equal("cpu       0            2"))
+		})
+
+		It("writes each result as a line of JSON", func() {
+			tc := setup(vector("1"), 200)
+			tc.httpClient.responseBody = []string{vector("1"), vector("2"), vector("2"), vector("2")}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+			defer cancel()
+			tc.ctx = ctx
+			tc.query(`cpu{source_id="app-a"}`, "--watch", "100ms")
+
+			Expect(tc.writer.lines()[:2]).To(Equal([]string{vector("1"), vector("2")}))
+		})
+
+		It("redraws each result in place and highlights the values that changed", func() {
+			tc := setup(vector("1"), 200)
+			tc.httpClient.responseBody = []string{vector("1"), vector("2"), vector("2"), vector("2")}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+			defer cancel()
+			tc.ctx = ctx
+			tc.queryWithOptions(
+				[]command.QueryOption{command.WithQueryTable(), command.WithQueryRedraw()},
+				`cpu{source_id="app-a"}`, "--watch", "100ms",
+			)
+
+			screens := strings.Split(string(tc.writer.bytes), "\x1b[H\x1b[2J")
+			Expect(len(screens)).To(BeNumerically(">=", 3))
+			Expect(screens[1]).To(HavePrefix(`Every 100ms: cpu{source_id="app-a"}`))
+			Expect(screens[1]).To(HaveSuffix("\n\n__name__  instance_id  Value\ncpu       0            1\n"))
+			Expect(screens[2]).To(HaveSuffix("\n\n__name__  instance_id  Value\ncpu       0            \x1b[7m2\x1b[27m\n"))
+		})
+
+		It("gives you an error if --watch is used with a range query", func() {
+			tc := setup("", 200)
+
+			Expect(func() {
+				tc.query(`cpu{source_id="app-a"}`, "--start", "-1h", "--end", "now", "--step", "1m", "--watch", "10s")
+			}).To(Panic())
+
+			Expect(tc.logger.fatalfMessage).To(Equal("--watch requires an instant query"))
+		})
+
+		It("gives you an error if --watch is used with --time", func() {
+			tc := setup("", 200)
+
+			Expect(func() {
+				tc.query(`cpu{source_id="app-a"}`, "--time", "-1h", "--watch", "10s")
+			}).To(Panic())
+
+			Expect(tc.logger.fatalfMessage).To(Equal("--watch cannot be used with --time"))
+		})
+
+		It("gives you an error if --watch is negative", func() {
+			tc := setup("", 200)
+
+			Expect(func() {
+				tc.query(`cpu{source_id="app-a"}`, "--watch", "-5s")
+			}).To(Panic())
+
+			Expect(tc.logger.fatalfMessage).To(Equal("--watch must be a positive duration"))
+		})
+	})
+
+	Describe("asserting on results", func() {
+		vector := `{"status":"success","data":{"resultType":"vector","result":[` +
+			`{"metric":{"instance_id":"0"},"value":[1580231000,"0.01"]},` +
+			`{"metric":{"instance_id":"1"},"value":[1580231000,"0.07"]}]}}`
+
+		It("passes when every series meets the assertion", func() {
+			tc := setup(vector, 200)
+
+			tc.query(`rate(errors{source_id="app-a"}[5m])`, "--assert", "< 0.1")
+
+			Expect(tc.writer.lines()).To(Equal([]string{vector}))
+			Expect(tc.logger.printfMessages).To(Equal([]string{"Assertion passed: 2 of 2 series < 0.1"}))
+			Expect(tc.exitCode).To(Equal(0))
+		})
+
+		It("fails with a report of the series that do not meet the assertion", func() {
+			tc := setup(vector, 200)
+
+			tc.query(`rate(errors{source_id="app-a"}[5m])`, "--assert", "< 0.05")
+
+			Expect(tc.logger.printfMessages).To(Equal([]string{
+				"Assertion failed: 1 of 2 series not < 0.05",
+				`  {instance_id="1"} = 0.07`,
+			}))
+			Expect(tc.exitCode).To(Equal(3))
+		})
+
+		It("passes when any series meets the assertion with --assert-mode any", func() {
+			tc := setup(vector, 200)
+
+			tc.query(`rate(errors{source_id="app-a"}[5m])`, "--assert", "<0.05", "--assert-mode", "any")
+
+			Expect(tc.logger.printfMessages).To(Equal([]string{"Assertion passed: 1 of 2 series < 0.05"}))
+			Expect(tc.exitCode).To(Equal(0))
+		})
+
+		It("requires every assertion to be met", func() {
+			tc := setup(vector, 200)
+
+			tc.query(`rate(errors{source_id="app-a"}[5m])`, "--assert", ">= 0", "--assert", "<= 0.01", "--assert-mode", "all")
+
+			Expect(tc.logger.printfMessages).To(Equal([]string{
+				"Assertion failed: 1 of 2 series not >= 0 and <= 0.01",
+				`  {instance_id="1"} = 0.07`,
+			}))
+			Expect(tc.exitCode).To(Equal(3))
+		})
+
+		It("asserts on scalars", func() {
+			tc := setup(`{"status":"success","data":{"resultType":"scalar","result":[1580231000,"2"]}}`, 200)
+
+			tc.query(`scalar(up)`, "--assert", "== 1")
+
+			Expect(tc.logger.printfMessages).To(Equal([]string{
+				"Assertion failed: 1 of 1 series not == 1",
+				"  scalar = 2",
+			}))
+			Expect(tc.exitCode).To(Equal(3))
+		})
+
+		It("fails distinctly when the query returns no data", func() {
+			tc := setup(`{"status":"success","data":{"resultType":"vector","result":[]}}`, 200)
+
+			tc.query(`up{source_id="app-a"}`, "--assert", "> 0")
+
+			Expect(tc.logger.printfMessages).To(Equal([]string{"Assertion failed: the query returned no data"}))
+			Expect(tc.exitCode).To(Equal(4))
+		})
+
+		It("does not assert when the query fails", func() {
+			tc := setup("", 503)
+
+			tc.query(`up{source_id="app-a"}`, "--assert", "> 0")
+
+			Expect(tc.logger.printfMessages).To(Equal([]string{"Could not process query: unexpected status code 503"}))
+			Expect(tc.exitCode).To(Equal(2))
+		})
+
+		DescribeTable("with invalid flags",
+			func(message string, args ...string) {
+				tc := setup("", 200)
+
+				Expect(func() {
+					tc.query(append([]string{`up{source_id="app-a"}`}, args...)...)
+				}).To(Panic())
+
+				Expect(tc.logger.fatalfMessage).To(Equal(message))
+			},
+			Entry("with an invalid assertion",
+				"invalid assertion '~ 1'. Ensure your assertion is a comparison with a number, such as '< 0.05'",
+				"--assert", "~ 1"),
+			Entry("with a threshold that is not a number",
+				"invalid assertion '< high'. Ensure your assertion is a comparison with a number, such as '< 0.05'",
+				"--assert", "< high"),
+			Entry("with an unknown mode",
+				"--assert-mode must be one of any or all",
+				"--assert", "< 1", "--assert-mode", "most"),
+			Entry("with a mode and no assertion",
+				"--assert-mode requires --assert",
+				"--assert-mode", "any"),
+			Entry("with a range query",
+				"--assert requires an instant query and cannot be used with --watch",
+				"--assert", "< 1", "--start", "-1h", "--end", "now", "--step", "1m"),
+		)
+	})
+
+	Describe("resolving source names", func() {
+		vector := `{"status":"success","data":{"resultType":"vector","result":[` +
+			`{"metric":{"source_id":"app-guid"},"value":[1580231000,"1"]},` +
+			`{"metric":{"source_id":"other-guid"},"value":[1580231000,"2"]}]}}`
+
+		It("replaces apps named in source_id selectors with their GUIDs", func() {
+			tc := setup(vector, 200)
+			tc.cliConnection.cliCommandResult = [][]string{{"app-guid"}}
+
+			tc.query(`sum(rate(http{source_id="app:my-app"}[5m])) / sum(rate(http{source_id='app:my-app'}[5m]))`)
+
+			Expect(tc.cliConnection.cliCommandArgs).To(Equal([][]string{{"app", "my-app", "--guid"}}))
+			requestURL, err := url.Parse(tc.httpClient.requestURLs[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requestURL.Query().Get("query")).To(Equal(
+				`sum(rate(http{source_id="app-guid"}[5m])) / sum(rate(http{source_id='app-guid'}[5m]))`,
+			))
+			Expect(tc.writer.lines()).To(Equal([]string{vector}))
+		})
+
+		It("replaces services named in source_id selectors with their GUIDs", func() {
+			tc := setup(vector, 200)
+			tc.cliConnection.cliCommandResult = [][]string{{"service-guid"}}
+
+			tc.query(`cpu{source_id!="service:my-db"}`)
+
+			Expect(tc.cliConnection.cliCommandArgs).To(Equal([][]string{{"service", "my-db", "--guid"}}))
+			requestURL, err := url.Parse(tc.httpClient.requestURLs[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requestURL.Query().Get("query")).To(Equal(`cpu{source_id!="service-guid"}`))
+		})
+
+		It("replaces placeholders with the GUIDs of the apps and services they name", func() {
+			tc := setup(vector, 200)
+			tc.cliConnection.cliCommandResult = [][]string{{"app-guid"}, {"service-guid"}}
+
+			tc.query(`cpu{source_id=~"{{app "my-app"}}|{{ service 'my-db' }}"}`)
+
+			requestURL, err := url.Parse(tc.httpClient.requestURLs[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requestURL.Query().Get("query")).To(Equal(`cpu{source_id=~"app-guid|service-guid"}`))
+		})
+
+		It("relabels the GUIDs in the result with --relabel-sources", func() {
+			tc := setup(vector, 200)
+			tc.cliConnection.cliCommandResult = [][]string{{"app-guid"}}
+
+			tc.queryWithOptions(
+				[]command.QueryOption{command.WithQueryTable()},
+				`cpu{source_id=~"{{app "my-app"}}|other-guid"}`, "--relabel-sources",
+			)
+
+			Expect(tc.writer.lines()).To(Equal([]string{
+				"source_id   Value",
+				"my-app      1",
+				"other-guid  2",
+			}))
+		})
+
+		It("leaves queries that do not name sources alone", func() {
+			tc := setup(vector, 200)
+
+			tc.query(`cpu{source_id="app-guid"}`, "--relabel-sources")
+
+			Expect(tc.cliConnection.cliCommandArgs).To(BeEmpty())
+			Expect(tc.writer.lines()).To(Equal([]string{vector}))
+		})
+
+		It("exits with an error when a source cannot be found", func() {
+			tc := setup(vector, 200)
+			tc.cliConnection.cliCommandResult = [][]string{{""}}
+			tc.cliConnection.cliCommandErr = []error{errors.New("App my-app not found")}
+
+			Expect(func() {
+				tc.query(`cpu{source_id="app:my-app"}`)
+			}).To(Panic())
+
+			Expect(tc.logger.fatalfMessage).To(Equal("could not find app 'my-app' in the targeted space"))
+			Expect(tc.logger.printfMessages).To(BeEmpty())
+			Expect(tc.httpClient.requestURLs).To(BeEmpty())
+		})
+	})
 })
 
 type testContext struct {
+	ctx           context.Context
 	cliConnection *stubCliConnection
 	httpClient    *stubHTTPClient
 	logger        *stubLogger
 	writer        *stubWriter
+	exitCode      int
 }
 
 func setup(responseBody string, responseCode int) *testContext {
@@ -256,6 +717,7 @@ func setup(responseBody string, responseCode int) *testContext {
 	httpClient.responseCode = responseCode
 
 	return &testContext{
+		ctx:           context.Background(),
 		cliConnection: newStubCliConnection(),
 		httpClient:    httpClient,
 		logger:        &stubLogger{},
@@ -264,11 +726,21 @@ func setup(responseBody string, responseCode int) *testContext {
 }
 
 func (tc *testContext) query(args ...string) {
+	tc.queryWithOptions(nil, args...)
+}
+
+func (tc *testContext) queryWithOptions(opts []command.QueryOption, args ...string) {
+	opts = append(opts, command.WithQueryExit(func(code int) {
+		tc.exitCode = code
+	}))
+
 	command.Query(
+		tc.ctx,
 		tc.cliConnection,
 		args,
 		tc.httpClient,
 		tc.logger,
 		tc.writer,
+		opts...,
 	)
 }
@@ -0,0 +1,321 @@
+package command
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// recordFields are the fields of an envelope record, in the order they are
+// written by default. Any other column names a tag. Logs only have a repeated
+// field when --dedupe collapsed more than one of them.
+var recordFields = []string{
+	"timestamp",
+	"source_id",
+	"source_name",
+	"instance_id",
+	"type",
+	"name",
+	"value",
+	"unit",
+	"payload",
+	"repeated",
+}
+
+// envelopeRecord is a flattened envelope with a value for each of the
+// recordFields that apply to it.
+type envelopeRecord struct {
+	*loggregator_v2.Envelope
+	fields map[string]string
+}
+
+// column returns the value of the named field, or of the tag with the name if
+// it is not a field. Tags may also be named with a "tags." prefix.
+func (r envelopeRecord) column(name string) string {
+	if v, ok := r.fields[name]; ok {
+		return v
+	}
+
+	if isRecordField(name) {
+		return ""
+	}
+
+	tag, _ := envelopeTag(r.Envelope, strings.TrimPrefix(name, "tags."))
+	return tag
+}
+
+// tags returns the names of every tag of the envelope, sorted.
+func (r envelopeRecord) tags() []string {
+	var names []string
+	for name := range r.GetTags() {
+		names = append(names, name)
+	}
+	for name := range r.GetDeprecatedTags() {
+		if _, ok := r.GetTags()[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isRecordField(name string) bool {
+	for _, f := range recordFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// envelopeRecords flattens an envelope into records. Gauges have a record for
+// each of their metrics and every other envelope has a single record. The
+// type of logs is their stream and the type of other envelopes is upper-cased
+// as it is in pretty output.
+func envelopeRecords(e *loggregator_v2.Envelope, sourceName string, newLine rune, timestamps timestampFormat, repeated int) []envelopeRecord {
+	base := map[string]string{
+		"timestamp":   timestamps.format(e.GetTimestamp()),
+		"source_id":   e.GetSourceId(),
+		"instance_id": e.GetInstanceId(),
+	}
+	if sourceName != "" {
+		base["source_name"] = sourceName
+	}
+
+	record := func(fields map[string]string) envelopeRecord {
+		for k, v := range base {
+			fields[k] = v
+		}
+		return envelopeRecord{Envelope: e, fields: fields}
+	}
+
+	switch e.Message.(type) {
+	case *loggregator_v2.Envelope_Log:
+		fields := map[string]string{
+			"type":    e.GetLog().GetType().String(),
+			"payload": logPayload(e, newLine),
+		}
+		if repeated > 1 {
+			fields["repeated"] = strconv.Itoa(repeated)
+		}
+		return []envelopeRecord{record(fields)}
+	case *loggregator_v2.Envelope_Counter:
+		return []envelopeRecord{record(map[string]string{
+			"type":  "COUNTER",
+			"name":  e.GetCounter().GetName(),
+			"value": strconv.FormatUint(e.GetCounter().GetTotal(), 10),
+		})}
+	case *loggregator_v2.Envelope_Gauge:
+		metrics := e.GetGauge().GetMetrics()
+		names := make([]string, 0, len(metrics))
+		for name := range metrics {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		records := make([]envelopeRecord, 0, len(names))
+		for _, name := range names {
+			records = append(records, record(map[string]string{
+				"type":  "GAUGE",
+				"name":  name,
+				"value": formatFloat(metrics[name].GetValue()),
+				"unit":  metrics[name].GetUnit(),
+			}))
+		}
+		return records
+	case *loggregator_v2.Envelope_Timer:
+		timer := e.GetTimer()
+		return []envelopeRecord{record(map[string]string{
+			"type":  "TIMER",
+			"name":  timer.GetName(),
+			"value": formatFloat(float64(timer.GetStop()-timer.GetStart()) / 1000000.0),
+			"unit":  "ms",
+		})}
+	case *loggregator_v2.Envelope_Event:
+		return []envelopeRecord{record(map[string]string{
+			"type":    "EVENT",
+			"name":    e.GetEvent().GetTitle(),
+			"payload": e.GetEvent().GetBody(),
+		})}
+	default:
+		return nil
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// logfmtFormatter writes every record as a line of key=value pairs. By default
+// every field that applies to the envelope is written, with its tags before
+// the payload.
+type logfmtFormatter struct {
+	baseFormatter
+	newLine    rune
+	timestamps timestampFormat
+	columns    []string
+}
+
+func (f logfmtFormatter) formatEnvelope(e *loggregator_v2.Envelope) (string, bool) {
+	return f.formatRepeated(e, 1)
+}
+
+func (f logfmtFormatter) formatRepeated(e *loggregator_v2.Envelope, repeated int) (string, bool) {
+	var sourceName string
+	if f.multiSource() {
+		sourceName = f.sourceName(e)
+	}
+
+	var lines []string
+	for _, r := range envelopeRecords(e, sourceName, f.newLine, f.timestamps, repeated) {
+		lines = append(lines, f.formatRecord(r))
+	}
+
+	if len(lines) == 0 {
+		return "", false
+	}
+	return strings.Join(lines, "\n"), true
+}
+
+func (f logfmtFormatter) formatRecord(r envelopeRecord) string {
+	var b strings.Builder
+	write := func(key, value string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(logfmtKey(key))
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(value))
+	}
+
+	if len(f.columns) > 0 {
+		for _, c := range f.columns {
+			write(c, r.column(c))
+		}
+		return b.String()
+	}
+
+	for _, field := range recordFields {
+		if field == "payload" {
+			for _, tag := range r.tags() {
+				write("tags."+tag, r.column("tags."+tag))
+			}
+		}
+
+		if v, ok := r.fields[field]; ok {
+			write(field, v)
+		}
+	}
+	return b.String()
+}
+
+// logfmtKey replaces every character that is not allowed in a logfmt key with
+// an underscore.
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue quotes a value if it is empty or contains spaces, quotes, equals
+// signs or control characters.
+func logfmtValue(value string) string {
+	needsQuotes := value == "" || strings.IndexFunc(value, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || !unicode.IsPrint(r)
+	}) >= 0
+	if !needsQuotes {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// csvFormatter writes every record as a row of comma-separated values, after a
+// row naming the columns. When writing to output files, the files start each
+// new or empty file with the row naming the columns instead.
+type csvFormatter struct {
+	baseFormatter
+	newLine     rune
+	timestamps  timestampFormat
+	columns     []string
+	fileHeaders bool
+
+	headerWritten bool
+}
+
+func (f *csvFormatter) formatEnvelope(e *loggregator_v2.Envelope) (string, bool) {
+	return f.formatRepeated(e, 1)
+}
+
+func (f *csvFormatter) formatRepeated(e *loggregator_v2.Envelope, repeated int) (string, bool) {
+	var sourceName string
+	if f.multiSource() {
+		sourceName = f.sourceName(e)
+	}
+
+	records := envelopeRecords(e, sourceName, f.newLine, f.timestamps, repeated)
+	if len(records) == 0 {
+		return "", false
+	}
+
+	columns := f.columnNames()
+
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+
+	if !f.fileHeaders && !f.headerWritten {
+		f.headerWritten = true
+		_ = w.Write(columns)
+	}
+
+	for _, r := range records {
+		row := make([]string, len(columns))
+		for i, c := range columns {
+			row[i] = r.column(c)
+		}
+		_ = w.Write(row)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.log.Printf("failed to write envelope as CSV: %s", err)
+		return "", false
+	}
+
+	return b.String(), true
+}
+
+// fileHeader returns the row naming the columns that starts every output
+// file.
+func (f *csvFormatter) fileHeader() string {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	_ = w.Write(f.columnNames())
+	w.Flush()
+	return b.String()
+}
+
+// columnNames returns the columns that are written. By default they are every
+// field but repeated, with the name of the source only when more than one is
+// tailed.
+func (f *csvFormatter) columnNames() []string {
+	if len(f.columns) > 0 {
+		return f.columns
+	}
+
+	var columns []string
+	for _, field := range recordFields {
+		if field == "repeated" || field == "source_name" && !f.multiSource() {
+			continue
+		}
+		columns = append(columns, field)
+	}
+	return columns
+}
@@ -0,0 +1,229 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+const (
+	// defaultStatsInterval is how often statistics are written while
+	// following by default.
+	defaultStatsInterval = 10 * time.Second
+
+	// topMessages is how many of the most repeated messages are written.
+	topMessages = 10
+
+	// maxMessageLength is the longest a repeated message is written.
+	maxMessageLength = 100
+)
+
+var (
+	guidPattern   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	numberPattern = regexp.MustCompile(`\d+`)
+)
+
+// stats summarizes envelopes instead of writing them.
+type stats struct {
+	formatter   formatter
+	multiSource bool
+	// interval is how often statistics are reported while following.
+	interval time.Duration
+	reported time.Time
+
+	envelopes   int
+	first, last int64
+	instances   map[string]int
+	sourceTypes map[string]int
+	streams     map[loggregator_v2.Log_Type]int
+	messages    map[string]int
+	timers      map[string][]time.Duration
+}
+
+func newStats(f formatter, multiSource bool, interval time.Duration) *stats {
+	s := &stats{formatter: f, multiSource: multiSource, interval: interval, reported: time.Now()}
+	s.reset()
+	return s
+}
+
+func (s *stats) reset() {
+	s.envelopes = 0
+	s.first, s.last = 0, 0
+	s.instances = make(map[string]int)
+	s.sourceTypes = make(map[string]int)
+	s.streams = make(map[loggregator_v2.Log_Type]int)
+	s.messages = make(map[string]int)
+	s.timers = make(map[string][]time.Duration)
+}
+
+func (s *stats) add(e *loggregator_v2.Envelope) {
+	s.envelopes++
+	if s.first == 0 || e.GetTimestamp() < s.first {
+		s.first = e.GetTimestamp()
+	}
+	if e.GetTimestamp() > s.last {
+		s.last = e.GetTimestamp()
+	}
+
+	s.instances[s.instance(e)]++
+
+	sourceType, ok := envelopeTag(e, "source_type")
+	if !ok {
+		sourceType = "unknown"
+	}
+	s.sourceTypes[sourceType]++
+
+	switch e.Message.(type) {
+	case *loggregator_v2.Envelope_Log:
+		s.streams[e.GetLog().GetType()]++
+		s.messages[normalizeMessage(string(e.GetLog().GetPayload()))]++
+	case *loggregator_v2.Envelope_Timer:
+		timer := e.GetTimer()
+		s.timers[timer.GetName()] = append(s.timers[timer.GetName()], time.Duration(timer.GetStop()-timer.GetStart()))
+	}
+}
+
+// instance names the instance that emitted e, along with its source when
+// more than one source is tailed.
+func (s *stats) instance(e *loggregator_v2.Envelope) string {
+	instance := e.GetInstanceId()
+	if instance == "" {
+		instance = "unknown"
+	}
+
+	if s.multiSource {
+		return s.formatter.sourceName(e) + "/" + instance
+	}
+	return instance
+}
+
+// due reports whether the interval has passed since the last report.
+func (s *stats) due() bool {
+	return s.interval > 0 && time.Since(s.reported) >= s.interval
+}
+
+// report returns the statistics of the envelopes added since the last
+// report, and resets them.
+func (s *stats) report() []string {
+	defer s.reset()
+	s.reported = time.Now()
+
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 2, 2, ' ', 0)
+
+	span := time.Duration(s.last - s.first)
+	fmt.Fprintf(tw, "Envelopes:\t%d over %s\n", s.envelopes, span.Round(time.Millisecond))
+
+	logs := s.streams[loggregator_v2.Log_OUT] + s.streams[loggregator_v2.Log_ERR]
+	if logs > 0 {
+		fmt.Fprintf(tw, "Logs:\t%d (OUT %d, ERR %d, %.1f%% ERR)\n",
+			logs,
+			s.streams[loggregator_v2.Log_OUT],
+			s.streams[loggregator_v2.Log_ERR],
+			100*float64(s.streams[loggregator_v2.Log_ERR])/float64(logs),
+		)
+		if span > 0 {
+			fmt.Fprintf(tw, "Logs per second:\t%.2f\n", float64(logs)/span.Seconds())
+		}
+	}
+
+	writeCounts(tw, "Instances", s.instances)
+	writeCounts(tw, "Source types", s.sourceTypes)
+	s.writeMessages(tw)
+	s.writeTimers(tw)
+
+	_ = tw.Flush()
+	return strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+}
+
+// writeCounts writes the counts in descending order.
+func writeCounts(tw *tabwriter.Writer, title string, counts map[string]int) {
+	if len(counts) == 0 {
+		return
+	}
+
+	fmt.Fprintf(tw, "\n%s:\n", title)
+	for _, name := range sortedByCount(counts) {
+		fmt.Fprintf(tw, "  %s\t%d\n", name, counts[name])
+	}
+}
+
+func (s *stats) writeMessages(tw *tabwriter.Writer) {
+	if len(s.messages) == 0 {
+		return
+	}
+
+	fmt.Fprintf(tw, "\nTop messages:\n")
+	for i, message := range sortedByCount(s.messages) {
+		if i == topMessages {
+			break
+		}
+		fmt.Fprintf(tw, "  %d\t%s\n", s.messages[message], trunc(maxMessageLength, message))
+	}
+}
+
+func (s *stats) writeTimers(tw *tabwriter.Writer) {
+	if len(s.timers) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(s.timers))
+	for name := range s.timers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(tw, "\nTimers:\n")
+	fmt.Fprintf(tw, "  NAME\tCOUNT\tP50\tP95\tP99\n")
+	for _, name := range names {
+		durations := s.timers[name]
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		fmt.Fprintf(tw, "  %s\t%d\t%s\t%s\t%s\n",
+			name,
+			len(durations),
+			percentile(durations, 50),
+			percentile(durations, 95),
+			percentile(durations, 99),
+		)
+	}
+}
+
+// sortedByCount returns the names in descending order of their counts, and
+// in alphabetical order when the counts are equal.
+func sortedByCount(counts map[string]int) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// normalizeMessage replaces the GUIDs and numbers in a message so that
+// messages that differ only by them are counted together.
+func normalizeMessage(message string) string {
+	message = guidPattern.ReplaceAllString(message, "<guid>")
+	message = numberPattern.ReplaceAllString(message, "<n>")
+	return strings.TrimSpace(message)
+}
@@ -2,11 +2,17 @@ package command
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
+	"net/url"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 	"unicode/utf8"
@@ -19,6 +25,7 @@ import (
 	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
 	"github.com/blang/semver/v4"
 	flags "github.com/jessevdk/go-flags"
+	"google.golang.org/protobuf/proto"
 )
 
 type TailOption func(*tailOptions)
@@ -29,8 +36,44 @@ func WithTailNoHeaders() TailOption {
 	}
 }
 
-// Tail will fetch the logs for a given application guid and write them to
-// stdout.
+// WithTailColor colorizes the default output format. It has no effect when
+// --no-color is given.
+func WithTailColor() TailOption {
+	return func(o *tailOptions) {
+		o.color = true
+	}
+}
+
+// WithTailErrWriter sets where ERR logs are written when --stderr is given.
+func WithTailErrWriter(w io.Writer) TailOption {
+	return func(o *tailOptions) {
+		o.errWriter = w
+	}
+}
+
+// WithTailAppRefreshInterval sets how often the apps in the targeted space or
+// org are listed while following them.
+func WithTailAppRefreshInterval(d time.Duration) TailOption {
+	return func(o *tailOptions) {
+		o.appRefreshInterval = d
+	}
+}
+
+// WithTailRandom sets the source of the random numbers in [0, 1) that pick
+// the envelopes kept by --sample.
+func WithTailRandom(random func() float64) TailOption {
+	return func(o *tailOptions) {
+		o.random = random
+	}
+}
+
+// mergeInterval is how long envelopes are buffered while following multiple
+// sources so that they can be written in timestamp order.
+const mergeInterval = 250 * time.Millisecond
+
+// Tail will fetch the logs for the given sources and write them to stdout.
+// When more than one source is given, the envelopes from every source are
+// merged into a single stream ordered by timestamp.
 func Tail(
 	ctx context.Context,
 	cli plugin.CliConnection,
@@ -49,12 +92,30 @@ func Tail(
 		opt(&o)
 	}
 
-	formatter := newFormatter(o.source.Name, o.follow, formatterKindFromOptions(o), log, o.outputTemplate, o.newLineReplacer)
+	formatter := newFormatter(o, log)
 	lw := lineWriter{w: w}
 
+	// Headers are always written to w, but envelopes are written to the
+	// output files when there are any.
+	out := &lw
+	var files *outputFiles
+	if o.outputFile != "" {
+		files, err = newOutputFiles(o, outputFileHeader(formatter), log)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+		out = files.writer("")
+
+		defer func() {
+			if err := files.Close(); err != nil {
+				log.Printf("Failed to close output files: %s", err)
+			}
+		}()
+	}
+
 	defer func() {
 		if value, ok := formatter.flush(); ok {
-			lw.Write(value)
+			out.Write(value)
 		}
 	}()
 
@@ -89,95 +150,737 @@ func Tail(
 
 	logCacheAddr := strings.Replace(tokenURL, "api", "log-cache", 1)
 
-	headerPrinter := formatter.sourceHeader
-	switch o.source.Type {
-	case _application:
-		headerPrinter = formatter.appHeader
-	case _service:
-		headerPrinter = formatter.serviceHeader
+	if !o.noHeaders {
+		writeHeader(&lw, formatter, o, org.Name, space.Name, user)
 	}
 
-	if !o.noHeaders {
-		header, ok := headerPrinter(o.source.Name, org.Name, space.Name, user)
-		if ok {
-			lw.Write(header)
-			lw.Write("")
+	c = http.NewTokenClient(c, cli.AccessToken,
+		http.WithTokenRefreshInterval(o.tokenRefreshInterval),
+		http.WithTokenLogger(log),
+	)
+
+	client := logcache.NewClient(logCacheAddr, logcache.WithHTTPClient(c))
+	read := sharedReader(client)
+
+	checkFeatureVersioning(client, ctx, log, o.nameFilter)
+
+	ew := newEnvelopeWriter(o, formatter, files, out, log)
+
+	if o.checkpointPath != "" {
+		ew.checkpoint, err = loadCheckpoint(o.checkpointPath)
+		if err != nil {
+			log.Fatalf("%s", err)
+		}
+
+		defer func() {
+			if err := ew.checkpoint.save(); err != nil {
+				log.Printf("Failed to save checkpoint: %s", err)
+			}
+		}()
+	}
+
+	walkStartTimes := make(map[string]int64, len(o.sources))
+
+	// Sources that are resumed from the checkpoint are not read again so
+	// that no envelope is written twice.
+	initial := o
+	if ew.checkpoint != nil {
+		initial.sources = ew.checkpoint.resume(o.sources, walkStartTimes)
+	}
+
+	err = readInitial(ctx, read, initial, walkStartTimes, ew.write)
+	if err != nil && !o.follow {
+		log.Fatalf("%s", err)
+	}
+
+	if o.follow {
+		var discover func() []source
+		if o.scope != scopeSources {
+			discover = appDiscoverer(cli, o, formatter, log)
+		}
+
+		followSources(ctx, read, o, walkStartTimes, discover, ew.write, ew.tick)
+	}
+
+	ew.flush()
+}
+
+// writeHeader writes the header describing the sources being tailed.
+func writeHeader(lw *lineWriter, f formatter, o tailOptions, org, space, user string) {
+	headerPrinter := f.sourceHeader
+	switch {
+	case o.scope == scopeSpace:
+		headerPrinter = f.spaceHeader
+	case o.scope == scopeOrg:
+		headerPrinter = f.orgHeader
+	case len(o.sources) > 1:
+		headerPrinter = f.sourcesHeader
+	case o.sources[0].Type == _application:
+		headerPrinter = f.appHeader
+	case o.sources[0].Type == _service:
+		headerPrinter = f.serviceHeader
+	}
+
+	names := strings.Join(sourceNames(o.sources), ", ")
+	header, ok := headerPrinter(names, org, space, user)
+	if ok {
+		lw.Write(header)
+		lw.Write("")
+	}
+}
+
+// envelopeWriter filters, formats and writes envelopes.
+type envelopeWriter struct {
+	o          tailOptions
+	formatter  formatter
+	grep       *grepper
+	throttle   *throttle
+	stitch     *stitcher
+	dedupe     *deduper
+	stats      *stats
+	checkpoint *checkpoint
+	files      *outputFiles
+	log        Logger
+
+	// out is where envelopes are written, except for ERR logs which are
+	// written to err.
+	out *lineWriter
+	err *lineWriter
+}
+
+func newEnvelopeWriter(o tailOptions, f formatter, files *outputFiles, out *lineWriter, log Logger) envelopeWriter {
+	w := envelopeWriter{
+		o:         o,
+		formatter: f,
+		grep:      newGrepper(o),
+		files:     files,
+		log:       log,
+		out:       out,
+		err:       out,
+	}
+
+	if o.stderr && o.errWriter != nil && files == nil {
+		w.err = &lineWriter{w: o.errWriter}
+	}
+
+	if o.maxRate > 0 || o.sample > 0 {
+		w.throttle = newThrottle(o)
+	}
+
+	if o.multiline {
+		w.stitch = newStitcher(o)
+	}
+
+	if o.dedupe {
+		w.dedupe = newDeduper(o)
+	}
+
+	if o.stats {
+		var interval time.Duration
+		if o.follow {
+			interval = o.statsInterval
+			if interval <= 0 {
+				interval = defaultStatsInterval
+			}
 		}
+		w.stats = newStats(f, o.filePerSource(), interval)
+	}
+
+	return w
+}
+
+func (w envelopeWriter) write(e *loggregator_v2.Envelope) {
+	if w.checkpoint != nil {
+		w.checkpoint.read(e)
+		defer w.checkpoint.recordSource(e.GetSourceId(), w.heldSince)
+	}
+
+	if !typeFilter(e, w.o) || !streamFilter(e, w.o) || !attributeFilter(e, w.o) || !whereFilter(e, w.o) {
+		return
 	}
 
-	filterAndFormat := func(e *loggregator_v2.Envelope) (string, bool) {
-		if !typeFilter(e, o) {
-			return "", false
+	if w.throttle != nil && !w.throttle.keep(e) {
+		return
+	}
+
+	if w.stitch != nil {
+		w.stitch.add(e, w.emit)
+		return
+	}
+	w.emit(e)
+}
+
+// emit writes e, or adds it to the statistics, if it is kept by grep.
+func (w envelopeWriter) emit(e *loggregator_v2.Envelope) {
+	switch {
+	case w.stats != nil:
+		w.grep.filter(e, w.stats.add)
+	case w.dedupe != nil:
+		w.grep.filter(e, w.collapse)
+	default:
+		w.grep.filter(e, w.format)
+	}
+}
+
+// collapse holds e until it is no longer repeated.
+func (w envelopeWriter) collapse(e *loggregator_v2.Envelope) {
+	w.dedupe.add(e, w.formatRepeated)
+}
+
+// tick writes the multi-line records that are no longer waiting for more
+// lines, the repeated logs that have been held for the dedupe timeout, and
+// the statistics and notice of dropped envelopes when they are due, and then
+// flushes the output files.
+func (w envelopeWriter) tick() {
+	if w.throttle != nil {
+		if notice, ok := w.throttle.notice(); ok {
+			w.log.Printf("%s", notice)
 		}
+	}
+
+	if w.stitch != nil {
+		w.stitch.flushIdle(w.emit)
+	}
+
+	if w.dedupe != nil {
+		w.dedupe.flushHeld(w.formatRepeated)
+	}
 
-		return formatter.formatEnvelope(e)
+	if w.stats != nil && w.stats.due() {
+		w.writeStats()
 	}
 
-	c = http.NewTokenClient(c, func() string {
-		token, err := cli.AccessToken()
+	if w.files != nil {
+		w.files.Flush()
+	}
+
+	// The checkpoint is only saved once what it records has been flushed.
+	if w.checkpoint != nil {
+		w.checkpoint.record(w.heldSince)
+		if w.checkpoint.due() {
+			if err := w.checkpoint.save(); err != nil {
+				w.log.Printf("Failed to save checkpoint: %s", err)
+			}
+		}
+	}
+}
+
+// flush writes every multi-line record, every repeated log and the
+// statistics, reports how many envelopes were dropped and flushes the output
+// files.
+func (w envelopeWriter) flush() {
+	if w.throttle != nil {
+		for _, line := range w.throttle.summary() {
+			w.log.Printf("%s", line)
+		}
+	}
+
+	if w.stitch != nil {
+		w.stitch.flush(w.emit)
+	}
+
+	if w.dedupe != nil {
+		w.dedupe.flush(w.formatRepeated)
+	}
+
+	if w.stats != nil {
+		w.writeStats()
+	}
+
+	if w.files != nil {
+		w.files.Flush()
+	}
+
+	if w.checkpoint != nil {
+		w.checkpoint.record(w.heldSince)
+	}
+}
+
+// heldSince returns the timestamp of the oldest envelope of the source that
+// is held to be written later, if any are.
+func (w envelopeWriter) heldSince(sourceID string) (int64, bool) {
+	var oldest int64
+	var holding bool
+	hold := func(timestamp int64, ok bool) {
+		if ok && (!holding || timestamp < oldest) {
+			oldest, holding = timestamp, true
+		}
+	}
+
+	hold(w.grep.heldSince(sourceID))
+	if w.stitch != nil {
+		hold(w.stitch.heldSince(sourceID))
+	}
+	if w.dedupe != nil {
+		hold(w.dedupe.heldSince(sourceID))
+	}
+	return oldest, holding
+}
+
+func (w envelopeWriter) writeStats() {
+	for _, line := range w.stats.report() {
+		w.out.Write(line)
+	}
+	w.out.Write("")
+}
+
+func (w envelopeWriter) format(e *loggregator_v2.Envelope) {
+	formatted, ok := w.formatter.formatEnvelope(e)
+	if ok {
+		w.writeFormatted(e, formatted)
+	}
+}
+
+func (w envelopeWriter) formatRepeated(e *loggregator_v2.Envelope, repeated int) {
+	formatted, ok := w.formatter.formatRepeated(e, repeated)
+	if ok {
+		w.writeFormatted(e, formatted)
+	}
+}
+
+// writeFormatted writes formatted e to the file of its source, or to err if
+// it is an ERR log, or to out.
+func (w envelopeWriter) writeFormatted(e *loggregator_v2.Envelope, formatted string) {
+	if w.files != nil {
+		w.files.writer(w.formatter.sourceName(e)).Write(formatted)
+		return
+	}
+
+	if e.GetLog().GetType() == loggregator_v2.Log_ERR {
+		w.err.Write(formatted)
+		return
+	}
+	w.out.Write(formatted)
+}
+
+// appDiscoverer returns a function that lists the apps in the targeted space
+// or org and returns the ones that are not being followed yet. The formatter
+// is told about every app that is returned.
+func appDiscoverer(cli plugin.CliConnection, o tailOptions, f formatter, log Logger) func() []source {
+	following := make(map[string]bool, len(o.sources))
+	for _, s := range o.sources {
+		following[s.id()] = true
+	}
+
+	return func() []source {
+		apps, err := listApps(cli, o.scope)
 		if err != nil {
-			log.Fatalf("Unable to get Access Token: %s", err)
+			log.Printf("Failed to refresh apps: %s", err)
+			return nil
 		}
-		return token
-	})
 
-	client := logcache.NewClient(logCacheAddr, logcache.WithHTTPClient(c))
+		var added []source
+		for _, app := range apps {
+			if following[app.id()] {
+				continue
+			}
+			following[app.id()] = true
+			f.addSource(app)
+			added = append(added, app)
+		}
+		return added
+	}
+}
 
-	checkFeatureVersioning(client, ctx, log, o.nameFilter)
+// maxConcurrentReads is the most reads made from Log Cache at once, however
+// many sources are tailed.
+const maxConcurrentReads = 8
+
+// sharedReader returns a Reader that every source can read from concurrently
+// using the one client. At most maxConcurrentReads reads are made at once. A
+// client discovers the path of the Log Cache API on its first read and is not
+// safe for concurrent use until it has, so reads are made one at a time until
+// one succeeds.
+func sharedReader(client *logcache.Client) logcache.Reader {
+	reads := make(chan struct{}, maxConcurrentReads)
+	var discovering sync.Mutex
+	var discovered atomic.Bool
+
+	return func(
+		ctx context.Context,
+		sourceID string,
+		start time.Time,
+		opts ...logcache.ReadOption,
+	) ([]*loggregator_v2.Envelope, error) {
+		select {
+		case reads <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		defer func() { <-reads }()
 
-	sourceID := o.source.GUID
-	if o.source.Type == _unknown {
-		// fall back to provided name
-		sourceID = o.source.Name
-	}
-
-	walkStartTime := time.Now().Add(-5 * time.Second).UnixNano()
-	if o.lines > 0 {
-		envelopes, err := client.Read(
-			context.Background(),
-			sourceID,
-			o.startTime,
-			logcache.WithEndTime(o.endTime),
-			logcache.WithEnvelopeTypes(o.envelopeType),
-			logcache.WithLimit(o.lines),
-			logcache.WithDescending(),
-			logcache.WithNameFilter(o.nameFilter),
-		)
-
-		if err != nil && !o.follow {
-			log.Fatalf("%s", err)
+		if !discovered.Load() {
+			discovering.Lock()
+			defer discovering.Unlock()
+		}
+
+		envelopes, err := client.Read(ctx, sourceID, start, opts...)
+		if err == nil {
+			discovered.Store(true)
+		}
+		return envelopes, err
+	}
+}
+
+// readInitial reads the most recent o.lines envelopes from every source and
+// passes them to visit in ascending timestamp order. Unless following, nothing
+// is visited if reading any source fails.
+func readInitial(
+	ctx context.Context,
+	read logcache.Reader,
+	o tailOptions,
+	walkStartTimes map[string]int64,
+	visit func(*loggregator_v2.Envelope),
+) error {
+	switch {
+	case o.lines == 0 || len(o.sources) == 0:
+		return nil
+	case o.lines > maxReadLimit && !o.batchesJSON():
+		return streamSources(ctx, read, o, walkStartTimes, visit)
+	}
+
+	envelopes, err := readSources(ctx, read, o, walkStartTimes)
+	if err != nil && !o.follow {
+		return err
+	}
+
+	for _, e := range envelopes {
+		visit(e)
+	}
+	return err
+}
+
+// readSources reads the most recent envelopes from every source concurrently,
+// with as many reads at once as read allows, and returns them merged in
+// ascending timestamp order. The start time for following each source is
+// recorded in walkStartTimes, keyed by source ID.
+func readSources(
+	ctx context.Context,
+	read logcache.Reader,
+	o tailOptions,
+	walkStartTimes map[string]int64,
+) ([]*loggregator_v2.Envelope, error) {
+	batches := make([][]*loggregator_v2.Envelope, len(o.sources))
+	errs := make([]error, len(o.sources))
+
+	var wg sync.WaitGroup
+	for i, s := range o.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = readPages(ctx, read, s.id(), o, func(page []*loggregator_v2.Envelope) {
+				batches[i] = append(batches[i], page...)
+			})
+		}()
+	}
+	wg.Wait()
+
+	var envelopes []*loggregator_v2.Envelope
+	for i, batch := range batches {
+		if len(batch) > 0 {
+			walkStartTimes[o.sources[i].id()] = batch[0].Timestamp + 1
 		}
 
 		// we get envelopes in descending order but want to print them ascending
-		for i := len(envelopes) - 1; i >= 0; i-- {
-			walkStartTime = envelopes[i].Timestamp + 1
-			if formatted, ok := filterAndFormat(envelopes[i]); ok {
-				lw.Write(formatted)
+		for j := len(batch) - 1; j >= 0; j-- {
+			envelopes = append(envelopes, batch[j])
+		}
+	}
+	sortByTimestamp(envelopes)
+
+	return envelopes, errors.Join(errs...)
+}
+
+// streamSources is like readSources but passes the envelopes to visit
+// without holding them all in memory. The pages of each source are read
+// newest first, so they are spooled to a temporary file and the spools are
+// merged from there oldest first.
+func streamSources(
+	ctx context.Context,
+	read logcache.Reader,
+	o tailOptions,
+	walkStartTimes map[string]int64,
+	visit func(*loggregator_v2.Envelope),
+) error {
+	spools := make([]*pageSpool, 0, len(o.sources))
+	defer func() {
+		for _, spool := range spools {
+			_ = spool.Close()
+		}
+	}()
+	for range o.sources {
+		spool, err := newPageSpool()
+		if err != nil {
+			return err
+		}
+		spools = append(spools, spool)
+	}
+
+	newest := make([]int64, len(o.sources))
+	errs := make([]error, len(o.sources))
+
+	var wg sync.WaitGroup
+	for i, s := range o.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var spoolErr error
+			err := readPages(ctx, read, s.id(), o, func(page []*loggregator_v2.Envelope) {
+				if newest[i] == 0 && len(page) > 0 {
+					newest[i] = page[0].Timestamp
+				}
+				if spoolErr == nil {
+					spoolErr = spools[i].add(page)
+				}
+			})
+			errs[i] = errors.Join(err, spoolErr)
+		}()
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	if err != nil && !o.follow {
+		return err
+	}
+
+	for i, s := range o.sources {
+		if newest[i] != 0 {
+			walkStartTimes[s.id()] = newest[i] + 1
+		}
+	}
+
+	return errors.Join(err, mergeSpools(spools, visit))
+}
+
+// maxReadLimit is the largest number of envelopes returned by a single Log
+// Cache read.
+const maxReadLimit = 1000
+
+// readPage is a single descending read made while paging backwards through a
+// source.
+type readPage struct {
+	end   time.Time
+	limit int
+
+	// seen holds the envelopes at the oldest timestamp of the previous page.
+	// They are read again by this page and skipped.
+	seen []*loggregator_v2.Envelope
+
+	// take is how many of the envelopes that were not seen are kept.
+	take int
+}
+
+func (p readPage) read(
+	ctx context.Context,
+	read logcache.Reader,
+	sourceID string,
+	o tailOptions,
+) ([]*loggregator_v2.Envelope, error) {
+	return read(
+		ctx,
+		sourceID,
+		o.startTime,
+		logcache.WithEndTime(p.end),
+		logcache.WithEnvelopeTypes(o.envelopeType),
+		logcache.WithLimit(p.limit),
+		logcache.WithDescending(),
+		logcache.WithNameFilter(o.nameFilter),
+	)
+}
+
+// fresh returns the envelopes in batch that were not seen by the previous
+// page, up to take of them.
+func (p readPage) fresh(batch []*loggregator_v2.Envelope) []*loggregator_v2.Envelope {
+	envelopes := make([]*loggregator_v2.Envelope, 0, len(batch))
+	for _, e := range batch {
+		if len(envelopes) == p.take {
+			break
+		}
+		if !containsEnvelope(p.seen, e) {
+			envelopes = append(envelopes, e)
+		}
+	}
+	return envelopes
+}
+
+// readPages reads the most recent o.lines envelopes from a source. Log Cache
+// returns at most maxReadLimit envelopes per read, so the range is paged
+// backwards with descending reads. Each page is passed to visit in descending
+// order, newest page first.
+func readPages(
+	ctx context.Context,
+	read logcache.Reader,
+	sourceID string,
+	o tailOptions,
+	visit func([]*loggregator_v2.Envelope),
+) error {
+	end := o.endTime
+	var seen []*loggregator_v2.Envelope
+	for remaining := o.lines; remaining > 0; {
+		p := readPage{
+			end:   end,
+			limit: min(remaining+len(seen), maxReadLimit),
+			seen:  seen,
+			take:  remaining,
+		}
+
+		batch, err := p.read(ctx, read, sourceID, o)
+		if err != nil {
+			return err
+		}
+
+		envelopes := p.fresh(batch)
+		visit(envelopes)
+		remaining -= len(envelopes)
+
+		if len(batch) < p.limit {
+			// There is nothing older in the range.
+			break
+		}
+
+		oldest := batch[len(batch)-1].Timestamp
+		if len(envelopes) == 0 {
+			// The whole page shares a timestamp that has already been read,
+			// so there is no way to read the rest of it.
+			end = time.Unix(0, oldest)
+			seen = nil
+			continue
+		}
+
+		// The next page ends just after the oldest timestamp in case more
+		// envelopes share it, so the ones already read are skipped.
+		end = time.Unix(0, oldest+1)
+		seen = envelopesAt(oldest, seen, envelopes)
+	}
+
+	return nil
+}
+
+func envelopesAt(timestamp int64, groups ...[]*loggregator_v2.Envelope) []*loggregator_v2.Envelope {
+	var envelopes []*loggregator_v2.Envelope
+	for _, group := range groups {
+		for _, e := range group {
+			if e.GetTimestamp() == timestamp {
+				envelopes = append(envelopes, e)
 			}
 		}
 	}
+	return envelopes
+}
 
-	if o.follow {
-		logcache.Walk(
-			ctx,
-			sourceID,
-			logcache.Visitor(func(envelopes []*loggregator_v2.Envelope) bool {
-				for _, e := range envelopes {
-					if formatted, ok := filterAndFormat(e); ok {
-						lw.Write(formatted)
+func containsEnvelope(envelopes []*loggregator_v2.Envelope, e *loggregator_v2.Envelope) bool {
+	for _, other := range envelopes {
+		if proto.Equal(other, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// followSources walks every source concurrently and passes each envelope to
+// visit from the calling goroutine until ctx is done. When following more than
+// one source, envelopes are held for mergeInterval so that they can be
+// visited in timestamp order. If discover is not nil, it is called every
+// appRefreshInterval and any sources it returns are followed as well. idle is
+// called every mergeInterval. Every source is walked with read, which bounds
+// how many reads are made at once.
+func followSources(
+	ctx context.Context,
+	read logcache.Reader,
+	o tailOptions,
+	walkStartTimes map[string]int64,
+	discover func() []source,
+	visit func(*loggregator_v2.Envelope),
+	idle func(),
+) {
+	batches := make(chan []*loggregator_v2.Envelope)
+
+	var wg sync.WaitGroup
+	follow := func(sourceID string, startTime int64) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logcache.Walk(
+				ctx,
+				sourceID,
+				logcache.Visitor(func(envelopes []*loggregator_v2.Envelope) bool {
+					select {
+					case batches <- envelopes:
+						return true
+					case <-ctx.Done():
+						return false
 					}
-				}
-				return true
-			}),
-			client.Read,
-			logcache.WithWalkStartTime(time.Unix(0, walkStartTime)),
-			logcache.WithWalkEnvelopeTypes(o.envelopeType),
-			logcache.WithWalkBackoff(logcache.NewAlwaysRetryBackoff(250*time.Millisecond)),
-			logcache.WithWalkNameFilter(o.nameFilter),
-		)
+				}),
+				read,
+				logcache.WithWalkStartTime(time.Unix(0, startTime)),
+				logcache.WithWalkEnvelopeTypes(o.envelopeType),
+				logcache.WithWalkBackoff(logcache.NewAlwaysRetryBackoff(250*time.Millisecond)),
+				logcache.WithWalkNameFilter(o.nameFilter),
+			)
+		}()
+	}
+
+	lastRefresh := time.Now()
+	defaultStartTime := lastRefresh.Add(-5 * time.Second).UnixNano()
+	for _, s := range o.sources {
+		startTime, ok := walkStartTimes[s.id()]
+		if !ok {
+			startTime = defaultStartTime
+		}
+		follow(s.id(), startTime)
+	}
+
+	var refresh <-chan time.Time
+	if discover != nil {
+		refreshTicker := time.NewTicker(o.appRefreshInterval)
+		defer refreshTicker.Stop()
+		refresh = refreshTicker.C
+	}
+
+	ticker := time.NewTicker(mergeInterval)
+	defer ticker.Stop()
+
+	var pending []*loggregator_v2.Envelope
+	flush := func() {
+		sortByTimestamp(pending)
+		for _, e := range pending {
+			visit(e)
+		}
+		pending = pending[:0]
+	}
+
+	for {
+		select {
+		case envelopes := <-batches:
+			pending = append(pending, envelopes...)
+			if len(o.sources) == 1 && discover == nil {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+			idle()
+		case <-refresh:
+			// Start following new sources from the previous refresh so that
+			// nothing they emitted since then is missed.
+			startTime := lastRefresh.Add(-5 * time.Second).UnixNano()
+			lastRefresh = time.Now()
+			for _, s := range discover() {
+				follow(s.id(), startTime)
+			}
+		case <-ctx.Done():
+			wg.Wait()
+			flush()
+			return
+		}
 	}
 }
 
+func sortByTimestamp(envelopes []*loggregator_v2.Envelope) {
+	sort.SliceStable(envelopes, func(i, j int) bool {
+		return envelopes[i].GetTimestamp() < envelopes[j].GetTimestamp()
+	})
+}
+
 type lineWriter struct {
 	w io.Writer
 }
@@ -195,6 +898,16 @@ const (
 
 type envelopeClass int
 
+const (
+	scopeSources tailScope = iota
+	scopeSpace
+	scopeOrg
+)
+
+// tailScope determines which sources are tailed: the ones given as arguments
+// or every app in the targeted space or org.
+type tailScope int
+
 type tailOptions struct {
 	startTime     time.Time
 	endTime       time.Time
@@ -203,82 +916,230 @@ type tailOptions struct {
 	lines         int
 	follow        bool
 
-	source               source
+	sources              []source
+	scope                tailScope
+	appRefreshInterval   time.Duration
 	outputTemplate       *template.Template
+	location             *time.Location
+	timeLayout           string
 	jsonOutput           bool
+	jsonLines            bool
+	logfmtOutput         bool
+	csvOutput            bool
+	columns              []string
+	parseJSON            bool
+	fields               []string
+	stats                bool
+	statsInterval        time.Duration
+	multiline            bool
+	multilineStart       *regexp.Regexp
+	multilineTimeout     time.Duration
+	dedupe               bool
+	dedupeTimeout        time.Duration
+	maxRate              int
+	sample               float64
+	random               func() float64
 	tokenRefreshInterval time.Duration
 
 	nameFilter string
 
+	filterOptions
+
 	noHeaders       bool
 	newLineReplacer rune
+	stderr          bool
+	errWriter       io.Writer
+	color           bool
+	noColor         bool
+	checkpointPath  string
+
+	outputFile     string
+	maxFileSize    int64
+	rotateInterval time.Duration
+	gzipRotated    bool
+}
+
+// filterOptions select which envelopes are written after they are read.
+type filterOptions struct {
+	stream      string
+	instances   map[string]bool
+	sourceTypes map[string]bool
+	tags        map[string]string
+	where       map[string]string
+
+	grep          *regexp.Regexp
+	grepInvert    *regexp.Regexp
+	beforeContext int
+	afterContext  int
 }
 
 type tailOptionFlags struct {
-	StartTime     int64  `long:"start-time"`
-	EndTime       int64  `long:"end-time"`
-	EnvelopeType  string `long:"envelope-type" short:"t"`
-	Lines         uint   `long:"lines" short:"n" default:"10"`
-	Follow        bool   `long:"follow" short:"f"`
-	OutputFormat  string `long:"output-format" short:"o"`
-	JSONOutput    bool   `long:"json"`
-	EnvelopeClass string `long:"envelope-class" short:"c"`
-	NewLine       string `long:"new-line" optional:"true" optional-value:"\\u2028"`
-	NameFilter    string `long:"name-filter"`
+	StartTime        timeArgument  `long:"start-time"`
+	EndTime          timeArgument  `long:"end-time"`
+	Since            timeArgument  `long:"since"`
+	EnvelopeType     string        `long:"envelope-type" short:"t"`
+	Lines            uint          `long:"lines" short:"n" default:"10"`
+	Follow           bool          `long:"follow" short:"f"`
+	OutputFormat     string        `long:"output-format" short:"o"`
+	Timezone         string        `long:"timezone"`
+	TimeFormat       string        `long:"time-format"`
+	JSONOutput       bool          `long:"json"`
+	JSONLines        bool          `long:"json-lines"`
+	Output           string        `long:"output"`
+	Columns          string        `long:"columns"`
+	ParseJSON        bool          `long:"parse-json"`
+	Fields           string        `long:"fields"`
+	Where            []string      `long:"where"`
+	Stats            bool          `long:"stats"`
+	StatsInterval    time.Duration `long:"stats-interval"`
+	Multiline        bool          `long:"multiline"`
+	MultilineStart   string        `long:"multiline-start"`
+	MultilineTimeout time.Duration `long:"multiline-timeout"`
+	Dedupe           bool          `long:"dedupe"`
+	DedupeTimeout    time.Duration `long:"dedupe-timeout"`
+	MaxRate          string        `long:"max-rate"`
+	Sample           string        `long:"sample"`
+	EnvelopeClass    string        `long:"envelope-class" short:"c"`
+	NewLine          string        `long:"new-line" optional:"true" optional-value:"\\u2028"`
+	NameFilter       string        `long:"name-filter"`
+	Stream           string        `long:"stream"`
+	Stderr           bool          `long:"stderr"`
+	NoColor          bool          `long:"no-color"`
+	Checkpoint       string        `long:"checkpoint"`
+	OutputFile       string        `long:"output-file"`
+	MaxFileSize      string        `long:"max-file-size"`
+	RotateInterval   time.Duration `long:"rotate-interval"`
+	Gzip             bool          `long:"gzip"`
+	Instance         string        `long:"instance"`
+	SourceType       string        `long:"source-type"`
+	Tags             []string      `long:"tag"`
+	Grep             string        `long:"grep"`
+	GrepInvert       string        `long:"grep-v"`
+	BeforeContext    uint          `long:"before-context" short:"B"`
+	AfterContext     uint          `long:"after-context" short:"A"`
+	Space            bool          `long:"space"`
+	Org              bool          `long:"org"`
 }
 
 func newTailOptions(cli plugin.CliConnection, args []string, log Logger) (tailOptions, error) {
-	opts := tailOptionFlags{
-		EndTime: time.Now().UnixNano(),
-	}
+	opts := tailOptionFlags{}
 
 	args, err := flags.ParseArgs(&opts, args)
 	if err != nil {
 		return tailOptions{}, err
 	}
 
-	if len(args) != 1 {
-		return tailOptions{}, fmt.Errorf("expected 1 argument, got %d", len(args))
+	startTime, endTime, err := parseTimeRange(opts)
+	if err != nil {
+		return tailOptions{}, err
 	}
 
-	if opts.JSONOutput && opts.OutputFormat != "" {
-		return tailOptions{}, errors.New("cannot use output-format and json flags together")
+	scope, err := parseScope(opts, args)
+	if err != nil {
+		return tailOptions{}, err
 	}
 
-	if opts.EnvelopeType != "" && opts.EnvelopeClass != "" {
-		return tailOptions{}, errors.New("--envelope-type cannot be used with --envelope-class")
+	if err := opts.validate(); err != nil {
+		return tailOptions{}, err
 	}
 
 	if opts.EnvelopeClass != "" {
 		opts.EnvelopeType = "ANY"
 	}
 
+	location, err := parseTimeZone(opts.Timezone)
+	if err != nil {
+		return tailOptions{}, fmt.Errorf("couldn't parse --timezone: %s", err)
+	}
+
+	timeLayout, err := parseTimeFormat(opts.TimeFormat)
+	if err != nil {
+		return tailOptions{}, fmt.Errorf("couldn't parse --time-format: %s", err)
+	}
+
 	var outputTemplate *template.Template
 	if opts.OutputFormat != "" {
-		outputTemplate, err = parseOutputFormat(opts.OutputFormat)
+		layout := timeLayout
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		outputTemplate, err = parseOutputFormat(opts.OutputFormat, timestampFormat{location: location, layout: layout})
 		if err != nil {
 			log.Fatalf("%s", err)
 		}
 	}
 
-	source := source{Name: args[0]}
+	var maxFileSize int64
+	if opts.MaxFileSize != "" {
+		maxFileSize, err = parseFileSize(opts.MaxFileSize)
+		if err != nil {
+			return tailOptions{}, fmt.Errorf("couldn't parse --max-file-size: %s", err)
+		}
+	}
 
-	populateSource(&source, cli, log)
+	multilineStart, multilineTimeout, err := parseMultiline(opts)
+	if err != nil {
+		return tailOptions{}, err
+	}
+
+	maxRate, sample, err := parseThrottle(opts)
+	if err != nil {
+		return tailOptions{}, err
+	}
+
+	filters, err := newFilterOptions(opts)
+	if err != nil {
+		return tailOptions{}, err
+	}
+
+	sources, err := resolveSources(cli, scope, args, opts.Follow, log)
+	if err != nil {
+		return tailOptions{}, err
+	}
 
 	o := tailOptions{
-		startTime:            time.Unix(0, opts.StartTime),
-		endTime:              time.Unix(0, opts.EndTime),
+		startTime:            startTime,
+		endTime:              endTime,
 		envelopeType:         translateEnvelopeType(opts.EnvelopeType, log),
 		lines:                int(opts.Lines),
-		source:               source,
+		sources:              sources,
+		scope:                scope,
+		appRefreshInterval:   time.Minute,
 		follow:               opts.Follow,
 		outputTemplate:       outputTemplate,
-		jsonOutput:           opts.JSONOutput,
+		location:             location,
+		timeLayout:           timeLayout,
+		jsonOutput:           opts.JSONOutput || opts.JSONLines,
+		jsonLines:            opts.JSONLines,
+		parseJSON:            opts.ParseJSON,
+		fields:               parseFieldNames(opts.Fields),
+		stats:                opts.Stats,
+		statsInterval:        opts.StatsInterval,
+		multiline:            opts.Multiline,
+		multilineStart:       multilineStart,
+		multilineTimeout:     multilineTimeout,
+		dedupe:               opts.Dedupe,
+		dedupeTimeout:        dedupeTimeout(opts.DedupeTimeout),
+		maxRate:              maxRate,
+		sample:               sample,
+		random:               rand.Float64,
 		tokenRefreshInterval: 5 * time.Minute,
 		nameFilter:           opts.NameFilter,
+		filterOptions:        filters,
+		stderr:               opts.Stderr,
+		noColor:              opts.NoColor,
+		checkpointPath:       opts.Checkpoint,
+		outputFile:           opts.OutputFile,
+		maxFileSize:          maxFileSize,
+		rotateInterval:       opts.RotateInterval,
+		gzipRotated:          opts.Gzip,
 		envelopeClass:        toEnvelopeClass(opts.EnvelopeClass),
 	}
 
+	if err := o.parseOutput(opts.Output, opts.Columns); err != nil {
+		return tailOptions{}, err
+	}
+
 	if opts.NewLine != "" {
 		o.newLineReplacer, err = parseNewLineArgument(opts.NewLine)
 		if err != nil {
@@ -289,6 +1150,230 @@ func newTailOptions(cli plugin.CliConnection, args []string, log Logger) (tailOp
 	return o, o.validate()
 }
 
+// validate checks for flags that cannot be used together.
+func (opts tailOptionFlags) validate() error {
+	if err := opts.validateOutput(); err != nil {
+		return err
+	}
+
+	if opts.DedupeTimeout != 0 && !opts.Dedupe {
+		return errors.New("--dedupe-timeout requires --dedupe")
+	}
+
+	if opts.Dedupe && opts.Stats {
+		return errors.New("--dedupe cannot be used with --stats")
+	}
+
+	if !opts.ParseJSON && (opts.Fields != "" || len(opts.Where) > 0) {
+		return errors.New("--fields and --where require --parse-json")
+	}
+
+	if opts.Checkpoint != "" && !opts.Follow {
+		return errors.New("--checkpoint requires --follow")
+	}
+
+	if opts.EnvelopeType != "" && opts.EnvelopeClass != "" {
+		return errors.New("--envelope-type cannot be used with --envelope-class")
+	}
+
+	if opts.OutputFile == "" && (opts.MaxFileSize != "" || opts.RotateInterval != 0 || opts.Gzip) {
+		return errors.New("--max-file-size, --rotate-interval and --gzip require --output-file")
+	}
+
+	return nil
+}
+
+// validateOutput checks for output flags that cannot be used together.
+func (opts tailOptionFlags) validateOutput() error {
+	if (opts.JSONOutput || opts.JSONLines) && opts.OutputFormat != "" {
+		return errors.New("cannot use output-format and json flags together")
+	}
+
+	if opts.Output != "" && (opts.JSONOutput || opts.JSONLines || opts.OutputFormat != "") {
+		return errors.New("--output cannot be used with --json, --json-lines or --output-format")
+	}
+
+	if opts.Stderr && (opts.JSONOutput || opts.JSONLines || opts.OutputFormat != "") {
+		return errors.New("--stderr cannot be used with --json or --output-format")
+	}
+
+	if opts.Stats && (opts.JSONOutput || opts.JSONLines || opts.OutputFormat != "" || opts.Output != "") {
+		return errors.New("--stats cannot be used with --json, --json-lines, --output or --output-format")
+	}
+
+	if opts.StatsInterval != 0 && (!opts.Stats || !opts.Follow) {
+		return errors.New("--stats-interval requires --stats and --follow")
+	}
+
+	return nil
+}
+
+// parseOutput sets the output format selected by --output and the columns
+// written by the logfmt and CSV formats.
+func (o *tailOptions) parseOutput(output, columns string) error {
+	switch strings.ToLower(output) {
+	case "", "pretty":
+	case "json":
+		o.jsonOutput = true
+	case "ndjson":
+		o.jsonOutput = true
+		o.jsonLines = true
+	case "logfmt":
+		o.logfmtOutput = true
+	case "csv":
+		o.csvOutput = true
+	default:
+		return errors.New("--output must be one of pretty, json, ndjson, logfmt or csv")
+	}
+
+	if o.stderr && (o.jsonOutput || o.logfmtOutput || o.csvOutput) {
+		return fmt.Errorf("--stderr cannot be used with --output %s", output)
+	}
+
+	o.columns = parseFieldNames(columns)
+
+	if len(o.columns) > 0 && !o.logfmtOutput && !o.csvOutput {
+		return errors.New("--columns requires --output logfmt or --output csv")
+	}
+
+	return nil
+}
+
+// parseScope returns the scope selected by the flags and checks that the
+// number of arguments given is valid for it.
+func parseScope(opts tailOptionFlags, args []string) (tailScope, error) {
+	scope := scopeSources
+	switch {
+	case opts.Space && opts.Org:
+		return scope, errors.New("--space cannot be used with --org")
+	case opts.Space:
+		scope = scopeSpace
+	case opts.Org:
+		scope = scopeOrg
+	}
+
+	if scope != scopeSources && len(args) != 0 {
+		return scope, fmt.Errorf("expected 0 arguments with --space or --org, got %d", len(args))
+	}
+
+	if scope == scopeSources && len(args) < 1 {
+		return scope, fmt.Errorf("expected at least 1 argument, got %d", len(args))
+	}
+
+	return scope, nil
+}
+
+func newFilterOptions(opts tailOptionFlags) (filterOptions, error) {
+	stream := strings.ToUpper(opts.Stream)
+	if stream != "" && stream != "OUT" && stream != "ERR" {
+		return filterOptions{}, errors.New("--stream must be OUT or ERR")
+	}
+
+	tags, err := parseTagFilters(opts.Tags)
+	if err != nil {
+		return filterOptions{}, err
+	}
+
+	where, err := parseWhereFilters(opts.Where)
+	if err != nil {
+		return filterOptions{}, err
+	}
+
+	grep, err := parseGrepPattern(opts.Grep)
+	if err != nil {
+		return filterOptions{}, err
+	}
+
+	grepInvert, err := parseGrepPattern(opts.GrepInvert)
+	if err != nil {
+		return filterOptions{}, err
+	}
+
+	if grep == nil && grepInvert == nil && (opts.BeforeContext > 0 || opts.AfterContext > 0) {
+		return filterOptions{}, errors.New("--before-context and --after-context require --grep or --grep-v")
+	}
+
+	return filterOptions{
+		stream:        stream,
+		instances:     parseList(opts.Instance, strings.TrimSpace),
+		sourceTypes:   parseList(opts.SourceType, strings.ToUpper),
+		tags:          tags,
+		where:         where,
+		grep:          grep,
+		grepInvert:    grepInvert,
+		beforeContext: int(opts.BeforeContext),
+		afterContext:  int(opts.AfterContext),
+	}, nil
+}
+
+// resolveSources returns the sources to tail: the apps in the targeted space
+// or org, or the apps, services or source IDs named by args.
+func resolveSources(cli plugin.CliConnection, scope tailScope, args []string, follow bool, log Logger) ([]source, error) {
+	var sources []source
+	if scope != scopeSources {
+		apps, err := listApps(cli, scope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list apps: %s", err)
+		}
+
+		if len(apps) == 0 && !follow {
+			return nil, errors.New("no apps found")
+		}
+		sources = apps
+	}
+
+	seen := make(map[string]bool, len(args))
+	for _, name := range args {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		s := source{Name: name}
+		populateSource(&s, cli, log)
+		sources = append(sources, s)
+	}
+
+	return sources, nil
+}
+
+// parseTimeRange returns the start and end of the range to read. The start
+// defaults to the UNIX epoch and the end defaults to now. Integer times are
+// interpreted as UNIX nanoseconds.
+func parseTimeRange(opts tailOptionFlags) (time.Time, time.Time, error) {
+	now := time.Now()
+	startTime := time.Unix(0, 0)
+	endTime := now
+
+	if opts.Since != "" && opts.StartTime != "" {
+		return time.Time{}, time.Time{}, errors.New("--since cannot be used with --start-time")
+	}
+
+	var err error
+	if opts.StartTime != "" {
+		startTime, err = parseTime(opts.StartTime, now, time.Nanosecond)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("couldn't parse --start-time: %s", err)
+		}
+	}
+
+	if opts.Since != "" {
+		startTime, err = parseSince(opts.Since, now)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("couldn't parse --since: %s", err)
+		}
+	}
+
+	if opts.EndTime != "" {
+		endTime, err = parseTime(opts.EndTime, now, time.Nanosecond)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("couldn't parse --end-time: %s", err)
+		}
+	}
+
+	return startTime, endTime, nil
+}
+
 func toEnvelopeClass(class string) envelopeClass {
 	switch strings.ToUpper(class) {
 	case "METRICS":
@@ -311,9 +1396,38 @@ func formatterKindFromOptions(o tailOptions) formatterKind {
 		return templateFormat
 	}
 
+	if o.logfmtOutput {
+		return logfmtFormat
+	}
+
+	if o.csvOutput {
+		return csvFormat
+	}
+
 	return prettyFormat
 }
 
+// timestamps returns the format of timestamps. The layout is used unless
+// another format was chosen.
+func (o tailOptions) timestamps(layout string) timestampFormat {
+	if o.timeLayout != "" {
+		layout = o.timeLayout
+	}
+	return timestampFormat{location: o.location, layout: layout}
+}
+
+// filePerSource reports whether the envelopes of each source are written to
+// their own file when writing to output files.
+func (o tailOptions) filePerSource() bool {
+	return len(o.sources) > 1 || o.scope != scopeSources
+}
+
+// batchesJSON reports whether every envelope is written in a single JSON
+// batch once they have all been read.
+func (o tailOptions) batchesJSON() bool {
+	return o.jsonOutput && !o.jsonLines && !o.follow
+}
+
 func typeFilter(e *loggregator_v2.Envelope, o tailOptions) bool {
 	if o.envelopeClass == envelopeClassAny {
 		return true
@@ -329,15 +1443,62 @@ func typeFilter(e *loggregator_v2.Envelope, o tailOptions) bool {
 	return false
 }
 
+// streamFilter reports whether the envelope is a log written to the stream
+// being tailed.
+func streamFilter(e *loggregator_v2.Envelope, o tailOptions) bool {
+	if o.stream == "" {
+		return true
+	}
+
+	if _, ok := e.Message.(*loggregator_v2.Envelope_Log); !ok {
+		return false
+	}
+
+	return e.GetLog().GetType().String() == o.stream
+}
+
+// attributeFilter reports whether the envelope is from one of the instances
+// and source types being tailed and has every tag being filtered on.
+func attributeFilter(e *loggregator_v2.Envelope, o tailOptions) bool {
+	if o.instances != nil && !o.instances[e.GetInstanceId()] {
+		return false
+	}
+
+	if o.sourceTypes != nil {
+		sourceType, _ := envelopeTag(e, "source_type")
+		if !o.sourceTypes[strings.ToUpper(sourceType)] {
+			return false
+		}
+	}
+
+	for name, value := range o.tags {
+		if v, ok := envelopeTag(e, name); !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// envelopeTag returns the value of the named tag, falling back to the
+// envelope's deprecated tags.
+func envelopeTag(e *loggregator_v2.Envelope, name string) (string, bool) {
+	if value, ok := e.GetTags()[name]; ok {
+		return value, true
+	}
+
+	if value, ok := e.GetDeprecatedTags()[name]; ok {
+		return value.GetText(), true
+	}
+
+	return "", false
+}
+
 func (o tailOptions) validate() error {
 	if o.startTime.After(o.endTime) && o.endTime != time.Unix(0, 0) {
 		return errors.New("invalid date/time range. Ensure your start time is prior or equal the end time")
 	}
 
-	if o.lines > 1000 || o.lines < 0 {
-		return errors.New("lines cannot be greater than 1000")
-	}
-
 	_, err := regexp.Compile(o.nameFilter)
 	if err != nil {
 		return fmt.Errorf("invalid name filter '%s'. Ensure your name-filter is a valid regex", o.nameFilter)
@@ -346,13 +1507,65 @@ func (o tailOptions) validate() error {
 	return nil
 }
 
-func parseOutputFormat(f string) (*template.Template, error) {
-	templ := template.New("OutputFormat")
-	_, err := templ.Parse(f)
+// parseList splits a comma separated list into a set of its normalized
+// values. It returns nil if the list is empty.
+func parseList(list string, normalize func(string) string) map[string]bool {
+	if list == "" {
+		return nil
+	}
+
+	values := make(map[string]bool)
+	for _, v := range strings.Split(list, ",") {
+		values[normalize(strings.TrimSpace(v))] = true
+	}
+	return values
+}
+
+func parseTagFilters(filters []string) (map[string]string, error) {
+	tags := make(map[string]string, len(filters))
+	for _, f := range filters {
+		name, value, ok := strings.Cut(f, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid tag filter '%s'. Ensure your tag filter is in the format key=value", f)
+		}
+		tags[name] = value
+	}
+	return tags, nil
+}
+
+func parseWhereFilters(filters []string) (map[string]string, error) {
+	where := make(map[string]string, len(filters))
+	for _, f := range filters {
+		name, value, ok := strings.Cut(f, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid where filter '%s'. Ensure your where filter is in the format key=value", f)
+		}
+		where[name] = value
+	}
+	return where, nil
+}
+
+// parseFieldNames parses a comma separated list of names, in order.
+func parseFieldNames(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func parseGrepPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	r, err := regexp.Compile(pattern)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid grep pattern '%s'. Ensure your pattern is a valid regex", pattern)
 	}
-	return templ, nil
+	return r, nil
 }
 
 func translateEnvelopeType(t string, log Logger) logcache_v1.EnvelopeType {
@@ -394,6 +1607,73 @@ func populateSource(s *source, cli plugin.CliConnection, log Logger) {
 	s.Type = _unknown
 }
 
+// id returns the ID used to read the source from Log Cache. Sources that
+// could not be resolved to an app or service are read using their name.
+func (s source) id() string {
+	if s.Type == _unknown {
+		return s.Name
+	}
+	return s.GUID
+}
+
+// listApps returns every app in the targeted space or org.
+func listApps(cli plugin.CliConnection, scope tailScope) ([]source, error) {
+	var filter string
+	switch scope {
+	case scopeSpace:
+		space, err := cli.GetCurrentSpace()
+		if err != nil {
+			return nil, err
+		}
+		filter = "space_guids=" + space.Guid
+	case scopeOrg:
+		org, err := cli.GetCurrentOrg()
+		if err != nil {
+			return nil, err
+		}
+		filter = "organization_guids=" + org.Guid
+	}
+
+	var apps []source
+	endpoint := "/v3/apps?per_page=5000&" + filter
+	for endpoint != "" {
+		lines, err := cli.CliCommandWithoutTerminalOutput("curl", endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		var r sourceInfo
+		err = json.NewDecoder(strings.NewReader(strings.Join(lines, ""))).Decode(&r)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, app := range r.Resources {
+			app.Type = _application
+			apps = append(apps, app)
+		}
+
+		endpoint = ""
+		if r.Pagination.Next != nil {
+			next, err := url.Parse(r.Pagination.Next.Href)
+			if err != nil {
+				return nil, err
+			}
+			endpoint = next.RequestURI()
+		}
+	}
+
+	return apps, nil
+}
+
+func sourceNames(sources []source) []string {
+	names := make([]string, 0, len(sources))
+	for _, s := range sources {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
 func getAppGUID(appName string, cli plugin.CliConnection, log Logger) string {
 	r, err := cli.CliCommandWithoutTerminalOutput(
 		"app",
@@ -1,12 +1,17 @@
 package command_test
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"code.cloudfoundry.org/log-cache-cli/v4/internal/command"
@@ -282,7 +287,7 @@ var _ = Describe("LogCache", func() {
 				{"timestamp":"%d","source_id":"app-name","instance_id":"0","deprecated_tags":{},"tags":{},"timer":{"name":"http","start":"1517940773000000000","stop":"1517940773000000000"}},
 				{"timestamp":"%d","source_id":"app-name","instance_id":"0","deprecated_tags":{},"tags":{},"gauge":{"metrics":{"some-name":{"unit":"my-unit","value":99},"other-name":{"unit":"other-unit","value":0}}}},
 				{"timestamp":"%d","source_id":"app-name","instance_id":"0","deprecated_tags":{},"tags":{},"counter":{"name":"some-name","total":"99","delta":"0"}},
-				{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":"log body"}}
+				{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":"log body","type":"OUT"}}
 			]}`, startTime.UnixNano(), startTime.UnixNano(), startTime.UnixNano(), startTime.UnixNano(), startTime.UnixNano())))
 		})
 
@@ -335,7 +340,7 @@ var _ = Describe("LogCache", func() {
 
 			Expect(writer.bytes).To(MatchJSON(fmt.Sprintf(`{"batch":[
 				{"timestamp":"%d","source_id":"app-name","instance_id":"0","deprecated_tags":{},"tags":{},"event":{"title":"some-title","body":"some-body"}},
-				{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":"log body"}}
+				{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":"log body","type":"OUT"}}
 			]}`, startTime.UnixNano(), startTime.UnixNano())))
 
 			Expect(httpClient.requestURLs).ToNot(BeEmpty())
@@ -891,8 +896,8 @@ var _ = Describe("LogCache", func() {
 
 		It("accepts start-time, end-time, envelope-type, and lines flags", func() {
 			args := []string{
-				"--start-time", "100",
-				"--end-time", "123",
+				"--start-time", "1700000000000000100",
+				"--end-time", "1700000000000000123",
 				"--envelope-type", "gauge", // deliberately lowercase
 				"--lines", "99",
 				"app-name",
@@ -912,8 +917,8 @@ var _ = Describe("LogCache", func() {
 			Expect(requestURL.Scheme).To(Equal("https"))
 			Expect(requestURL.Host).To(Equal("log-cache.some-system.com"))
 			Expect(requestURL.Path).To(Equal("/v1/read/app-guid"))
-			Expect(requestURL.Query().Get("start_time")).To(Equal("100"))
-			Expect(requestURL.Query().Get("end_time")).To(Equal("123"))
+			Expect(requestURL.Query().Get("start_time")).To(Equal("1700000000000000100"))
+			Expect(requestURL.Query().Get("end_time")).To(Equal("1700000000000000123"))
 			Expect(requestURL.Query().Get("envelope_types")).To(Equal("GAUGE"))
 			Expect(requestURL.Query().Get("descending")).To(Equal("true"))
 			Expect(requestURL.Query().Get("limit")).To(Equal("99"))
@@ -993,6 +998,24 @@ var _ = Describe("LogCache", func() {
 			Expect(httpClient.requestHeaders[0].Get("Authorization")).To(Equal("bearer some-token"))
 		})
 
+		It("fatally logs if an access token cannot be fetched", func() {
+			cliConn.accessTokenErr = errors.New("not logged in")
+
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"some-app"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(ContainSubstring("unable to get access token: not logged in"))
+			Expect(httpClient.requestURLs).To(BeEmpty())
+		})
+
 		It("formats the output via text/template", func() {
 			httpClient.responseBody = []string{responseBody(time.Unix(0, 1))}
 			args := []string{
@@ -1032,7 +1055,7 @@ var _ = Describe("LogCache", func() {
 		})
 
 		It("allows for empty end time with populated start time", func() {
-			args := []string{"--start-time", "1000", "app-name"}
+			args := []string{"--start-time", "1700000000000000000", "app-name"}
 			Expect(func() {
 				command.Tail(
 					context.Background(),
@@ -1121,44 +1144,79 @@ var _ = Describe("LogCache", func() {
 			Expect(logger.fatalfMessage).To(Equal(`template: OutputFormat:1: function "INVALID" not defined`))
 		})
 
-		It("fatally logs if an output-format won't execute", func() {
+		It("skips envelopes that an output-format won't execute for", func() {
 			httpClient.responseBody = []string{`{"envelopes":{"batch":[{"source_id": "a", "timestamp": 1},{"source_id":"b", "timestamp":2}]}}`}
 			args := []string{
 				"--output-format", "{{.invalid 9}}",
 				"app-guid",
 			}
 
-			Expect(func() {
-				command.Tail(
-					context.Background(),
-					cliConn,
-					args,
-					httpClient,
-					logger,
-					writer,
-				)
-			}).To(Panic())
+			command.Tail(
+				context.Background(),
+				cliConn,
+				args,
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
 
-			Expect(logger.fatalfMessage).To(Equal(`Output template parsed, but failed to execute: template: OutputFormat:1:2: executing "OutputFormat" at <.invalid>: can't evaluate field invalid in type *loggregator_v2.Envelope`))
+			Expect(writer.bytes).To(BeEmpty())
+			Expect(logger.printfMessages).To(HaveLen(2))
+			Expect(logger.printfMessages[0]).To(Equal(`Output template failed to execute, skipping envelope: template: OutputFormat:1:2: executing "OutputFormat" at <.invalid>: can't evaluate field invalid in type command.templateEnvelope`))
 		})
 
-		It("fatally logs if lines is greater than 1000", func() {
+		It("provides functions to output templates", func() {
+			httpClient.responseBody = []string{deprecatedTagsResponseBody(time.Unix(0, 1500000000000000000))}
 			args := []string{
-				"--lines", "1001",
-				"some-app",
+				"--output-format", `{{formatTime "RFC3339" "UTC" .Timestamp}} {{tag "source_type" . | lower}} {{payload . | upper | trunc 3}} {{(time .Timestamp).UTC.Year}}`,
+				"app-guid",
 			}
-			Expect(func() {
-				command.Tail(
-					context.Background(),
-					cliConn,
-					args,
-					httpClient,
-					logger,
-					writer,
-				)
-			}).To(Panic())
 
-			Expect(logger.fatalfMessage).To(Equal("lines cannot be greater than 1000"))
+			command.Tail(
+				context.Background(),
+				cliConn,
+				args,
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(ContainElement("2017-07-14T02:40:00Z app/proc/web LOG 2017"))
+		})
+
+		It("provides functions for metrics to output templates", func() {
+			httpClient.responseBody = []string{
+				timerResponseBody(time.Unix(0, 1)),
+				gaugeResponseBody(time.Unix(0, 1)),
+			}
+
+			args := []string{"--output-format", `{{duration .}}`, "app-guid"}
+			command.Tail(context.Background(), cliConn, args, httpClient, logger, writer, command.WithTailNoHeaders())
+
+			args = []string{"--output-format", `{{gauge "some-name" .}} {{json .SourceName}}`, "app-guid"}
+			command.Tail(context.Background(), cliConn, args, httpClient, logger, writer, command.WithTailNoHeaders())
+
+			Expect(writer.lines()).To(Equal([]string{"1s", `99 "app-guid"`}))
+		})
+
+		It("writes envelopes as json from output templates", func() {
+			httpClient.responseBody = []string{counterResponseBody(time.Unix(0, 1))}
+			args := []string{"--output-format", `{{json .}}`, "app-guid"}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				args,
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(HaveLen(1))
+			Expect(writer.lines()[0]).To(MatchJSON(`{"timestamp":"1","source_id":"app-name","instance_id":"0","deprecated_tags":{},"tags":{},"counter":{"name":"some-name","total":"99","delta":"0"}}`))
 		})
 
 		It("accepts 0 for --lines", func() {
@@ -1233,7 +1291,7 @@ var _ = Describe("LogCache", func() {
 		})
 
 		It("fatally logs if the start > end", func() {
-			args := []string{"--start-time", "1000", "--end-time", "100", "app-name"}
+			args := []string{"--start-time", "1700000000000001000", "--end-time", "1700000000000000100", "app-name"}
 			Expect(func() {
 				command.Tail(
 					context.Background(),
@@ -1248,9 +1306,41 @@ var _ = Describe("LogCache", func() {
 			Expect(logger.fatalfMessage).To(Equal("invalid date/time range. Ensure your start time is prior or equal the end time"))
 		})
 
-		It("fatally logs if the name-filter regex is invalid", func() {
-			args := []string{"--name-filter", "*foo", "app-name"}
-			Expect(func() {
+		It("bounds only the initial lines with --end-time when following", func() {
+			httpClient.responseBody = []string{
+				responseBody(startTime.Add(-30 * time.Second)),
+				responseBodyAsc(startTime),
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+			command.Tail(
+				ctx,
+				cliConn,
+				[]string{"--follow", "--end-time", "-1m", "app-name"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			Expect(logger.fatalfMessage).To(BeEmpty())
+			Expect(len(httpClient.requestURLs)).To(BeNumerically(">=", 2))
+			requestURL, err := url.Parse(httpClient.requestURLs[0])
+			Expect(err).ToNot(HaveOccurred())
+			end, err := strconv.ParseInt(requestURL.Query().Get("end_time"), 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(end).To(BeNumerically("~", time.Now().Add(-time.Minute).UnixNano(), time.Second))
+
+			requestURL, err = url.Parse(httpClient.requestURLs[1])
+			Expect(err).ToNot(HaveOccurred())
+			start, err := strconv.ParseInt(requestURL.Query().Get("start_time"), 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(start).To(Equal(startTime.Add(-28*time.Second).UnixNano() + 1))
+		})
+
+		DescribeTable("accepts human-friendly times for --start-time and --end-time",
+			func(startArg, endArg string, expectedStart, expectedEnd func() time.Time) {
+				args := []string{"--start-time", startArg, "--end-time", endArg, "app-name"}
 				command.Tail(
 					context.Background(),
 					cliConn,
@@ -1259,24 +1349,88 @@ var _ = Describe("LogCache", func() {
 					logger,
 					writer,
 				)
-			}).To(Panic())
 
-			Expect(logger.fatalfMessage).To(Equal("invalid name filter '*foo'. Ensure your name-filter is a valid regex"))
+				Expect(httpClient.requestURLs).To(HaveLen(1))
+				requestURL, err := url.Parse(httpClient.requestURLs[0])
+				Expect(err).ToNot(HaveOccurred())
+				start, err := strconv.ParseInt(requestURL.Query().Get("start_time"), 10, 64)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(start).To(BeNumerically("~", expectedStart().UnixNano(), time.Second))
+				end, err := strconv.ParseInt(requestURL.Query().Get("end_time"), 10, 64)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(end).To(BeNumerically("~", expectedEnd().UnixNano(), time.Second))
+			},
+			Entry("with relative times", "-2h", "-15m",
+				func() time.Time { return time.Now().Add(-2 * time.Hour) },
+				func() time.Time { return time.Now().Add(-15 * time.Minute) },
+			),
+			Entry("with now", "-2h", "now",
+				func() time.Time { return time.Now().Add(-2 * time.Hour) },
+				time.Now,
+			),
+			Entry("with RFC3339 timestamps", "2018-02-23T19:00:00Z", "2018-02-23T20:00:00+01:00",
+				func() time.Time { return time.Date(2018, 2, 23, 19, 0, 0, 0, time.UTC) },
+				func() time.Time { return time.Date(2018, 2, 23, 19, 0, 0, 0, time.UTC) },
+			),
+		)
+
+		It("accepts a relative duration for --since", func() {
+			args := []string{"--since", "15m", "app-name"}
+			command.Tail(
+				context.Background(),
+				cliConn,
+				args,
+				httpClient,
+				logger,
+				writer,
+			)
+
+			Expect(httpClient.requestURLs).To(HaveLen(1))
+			requestURL, err := url.Parse(httpClient.requestURLs[0])
+			Expect(err).ToNot(HaveOccurred())
+			start, err := strconv.ParseInt(requestURL.Query().Get("start_time"), 10, 64)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(start).To(BeNumerically("~", time.Now().Add(-15*time.Minute).UnixNano(), time.Second))
 		})
 
-		It("fatally logs if too many arguments are given", func() {
+		DescribeTable("fatally logs for invalid or ambiguous time ranges",
+			func(args []string, message string) {
+				Expect(func() {
+					command.Tail(
+						context.Background(),
+						cliConn,
+						append(args, "app-name"),
+						httpClient,
+						logger,
+						writer,
+					)
+				}).To(Panic())
+
+				Expect(logger.fatalfMessage).To(Equal(message))
+			},
+			Entry("with an invalid start time", []string{"--start-time", "yesterday"}, "couldn't parse --start-time: invalid time format: yesterday"),
+			Entry("with a positive relative start time", []string{"--start-time", "2h"}, "couldn't parse --start-time: invalid time format: 2h"),
+			Entry("with an invalid end time", []string{"--end-time", "2018-02-23T19:00:00"}, "couldn't parse --end-time: invalid time format: 2018-02-23T19:00:00"),
+			Entry("with a start time in seconds", []string{"--start-time", "1700000000"}, "couldn't parse --start-time: invalid time: 1700000000 is too small to be UNIX nanoseconds. Ensure integer times are in nanoseconds, such as 1700000000000000000"),
+			Entry("with an invalid since", []string{"--since", "-15m"}, "couldn't parse --since: invalid duration: -15m"),
+			Entry("with both --since and --start-time", []string{"--since", "15m", "--start-time", "-1h"}, "--since cannot be used with --start-time"),
+			Entry("with an inverted relative range", []string{"--start-time", "-1h", "--end-time", "-2h"}, "invalid date/time range. Ensure your start time is prior or equal the end time"),
+		)
+
+		It("fatally logs if the name-filter regex is invalid", func() {
+			args := []string{"--name-filter", "*foo", "app-name"}
 			Expect(func() {
 				command.Tail(
 					context.Background(),
 					cliConn,
-					[]string{"one", "two"},
+					args,
 					httpClient,
 					logger,
 					writer,
 				)
 			}).To(Panic())
 
-			Expect(logger.fatalfMessage).To(Equal("expected 1 argument, got 2"))
+			Expect(logger.fatalfMessage).To(Equal("invalid name filter '*foo'. Ensure your name-filter is a valid regex"))
 		})
 
 		It("fatally logs if not enough arguments are given", func() {
@@ -1291,7 +1445,7 @@ var _ = Describe("LogCache", func() {
 				)
 			}).To(Panic())
 
-			Expect(logger.fatalfMessage).To(Equal("expected 1 argument, got 0"))
+			Expect(logger.fatalfMessage).To(Equal("expected at least 1 argument, got 0"))
 		})
 
 		Context("when name-filter argument is not supplied", func() {
@@ -1586,103 +1740,2578 @@ var _ = Describe("LogCache", func() {
 			Expect(logger.printfMessages).To(ContainElement("service not found"))
 		})
 	})
-})
 
-func responseBody(startTime time.Time) string {
-	// NOTE: These are in descending order.
-	return fmt.Sprintf(responseTemplate,
-		startTime.Add(2*time.Second).UnixNano(),
-		startTime.Add(1*time.Second).UnixNano(),
-		startTime.UnixNano(),
-	)
-}
+	Context("when writing json lines", func() {
+		It("writes every envelope as a json object on its own line", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--json-lines", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
 
-func responseBodyAsc(startTime time.Time) string {
-	// NOTE: These are in ascending order.
-	return fmt.Sprintf(responseTemplate,
-		startTime.UnixNano(),
-		startTime.Add(1*time.Second).UnixNano(),
-		startTime.Add(2*time.Second).UnixNano(),
-	)
-}
+			lines := writer.lines()
+			Expect(lines).To(HaveLen(3))
 
-func responseBodyWithNewLine(startTime time.Time, newLine rune) string {
-	// NOTE: These are in descending order.
-	payload := fmt.Sprintf("log%sbody", string(newLine))
-	encoded := base64.StdEncoding.EncodeToString([]byte(payload))
-	return fmt.Sprintf(responseTemplateWithNewLine,
-		encoded,
-		startTime.Add(2*time.Second).UnixNano(),
-		startTime.Add(1*time.Second).UnixNano(),
-		startTime.UnixNano(),
-	)
-}
+			logJSON := `{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":"log body","type":"%s"}}`
+			Expect(lines[0]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.UnixNano(), "ERR")))
+			Expect(lines[1]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.Add(1*time.Second).UnixNano(), "OUT")))
+			Expect(lines[2]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.Add(2*time.Second).UnixNano(), "OUT")))
+		})
 
-func responseBodyAscWithNewLine(startTime time.Time, newLine rune) string {
-	// NOTE: These are in ascending order.
-	payload := fmt.Sprintf("log%sbody", string(newLine))
-	encoded := base64.StdEncoding.EncodeToString([]byte(payload))
-	return fmt.Sprintf(responseTemplateWithNewLine,
-		encoded,
-		startTime.UnixNano(),
-		startTime.Add(1*time.Second).UnixNano(),
-		startTime.Add(2*time.Second).UnixNano(),
-	)
-}
+		It("writes metrics as json objects on their own lines", func() {
+			httpClient.responseBody = []string{mixedResponseBody(startTime)}
 
-func deprecatedTagsResponseBody(startTime time.Time) string {
-	// NOTE: These are in descending order.
-	return fmt.Sprintf(deprecatedTagsResponseTemplate,
-		startTime.Add(2*time.Second).UnixNano(),
-		startTime.Add(1*time.Second).UnixNano(),
-		startTime.UnixNano(),
-	)
-}
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--json-lines", "--envelope-class", "metrics", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
 
-func counterResponseBody(startTime time.Time) string {
-	return fmt.Sprintf(counterResponseTemplate,
-		startTime.UnixNano(),
-	)
-}
+			lines := writer.lines()
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[2]).To(MatchJSON(fmt.Sprintf(
+				`{"timestamp":"%d","source_id":"app-name","instance_id":"0","deprecated_tags":{},"tags":{},"counter":{"name":"some-name","total":"99","delta":"0"}}`,
+				startTime.UnixNano(),
+			)))
+		})
 
-func gaugeResponseBody(startTime time.Time) string {
-	return fmt.Sprintf(gaugeResponseTemplate,
-		startTime.UnixNano(),
-	)
-}
+		It("fatally logs if used with --output-format", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--json-lines", "--output-format", "{{.Timestamp}}", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
 
-func timerResponseBody(startTime time.Time) string {
-	return fmt.Sprintf(timerResponseTemplate,
-		startTime.UnixNano(),
-		startTime.Add(1*time.Second).UnixNano(),
-		startTime.Add(2*time.Second).UnixNano(),
-	)
-}
+			Expect(logger.fatalfMessage).To(Equal("cannot use output-format and json flags together"))
+		})
+	})
 
-func eventResponseBody(startTime time.Time) string {
-	return fmt.Sprintf(eventResponseTemplate,
-		startTime.UnixNano(),
-	)
-}
+	Context("when writing logfmt or csv", func() {
+		var ts string
 
-func mixedResponseBody(startTime time.Time) string {
-	return fmt.Sprintf(mixedResponseTemplate,
-		startTime.UnixNano(),
-		"0",
-	)
-}
+		BeforeEach(func() {
+			ts = time.Unix(0, startTime.UnixNano()).Format(time.RFC3339Nano)
+		})
 
-func mixedResponseBodyNoInstanceId(startTime time.Time) string {
-	return fmt.Sprintf(mixedResponseTemplate,
-		startTime.UnixNano(),
-		"",
-	)
-}
+		It("writes every envelope as logfmt", func() {
+			httpClient.responseBody = []string{mixedResponseBody(startTime)}
 
-func emptyResponseBody() string {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output", "logfmt", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			prefix := fmt.Sprintf("timestamp=%s source_id=app-name instance_id=0 ", ts)
+			Expect(writer.lines()).To(ConsistOf(
+				prefix+`type=OUT tags.source_type=APP/PROC/WEB payload="log body"`,
+				prefix+"type=COUNTER name=some-name value=99",
+				prefix+"type=GAUGE name=other-name value=0 unit=other-unit",
+				prefix+"type=GAUGE name=some-name value=99 unit=my-unit",
+				prefix+"type=TIMER name=http value=0 unit=ms",
+				prefix+"type=EVENT name=some-title payload=some-body",
+			))
+		})
+
+		It("writes the given columns as logfmt", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime, `say "hi" \ bye`)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output", "logfmt", "--columns", "type,source_type,name,payload", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				`type=OUT source_type=APP/PROC/WEB name="" payload="say \"hi\" \\ bye"`,
+			}))
+		})
+
+		It("writes every envelope as csv", func() {
+			httpClient.responseBody = []string{mixedResponseBody(startTime)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output", "CSV", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			lines := writer.lines()
+			Expect(lines).To(HaveLen(7))
+			Expect(lines[0]).To(Equal("timestamp,source_id,instance_id,type,name,value,unit,payload"))
+
+			prefix := ts + ",app-name,0,"
+			Expect(lines[1:]).To(ConsistOf(
+				prefix+"OUT,,,,log body",
+				prefix+"COUNTER,some-name,99,,",
+				prefix+"GAUGE,other-name,0,other-unit,",
+				prefix+"GAUGE,some-name,99,my-unit,",
+				prefix+"TIMER,http,0,ms,",
+				prefix+"EVENT,some-title,,,some-body",
+			))
+		})
+
+		It("escapes csv values", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime, `a,"b"`, "c\nd")}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output", "csv", "--columns", "source_type, payload", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				"source_type,payload",
+				`APP/PROC/WEB,"a,""b"""`,
+				`APP/PROC/WEB,"c`,
+				`d"`,
+			}))
+		})
+
+		It("writes json lines with --output ndjson", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output", "ndjson", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(HaveLen(3))
+		})
+
+		It("fatally logs if the output format is unknown", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--output", "xml", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--output must be one of pretty, json, ndjson, logfmt or csv"))
+		})
+
+		It("fatally logs if --output is used with --json", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--output", "csv", "--json", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--output cannot be used with --json, --json-lines or --output-format"))
+		})
+
+		It("fatally logs if --columns is used without logfmt or csv output", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--columns", "payload", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--columns requires --output logfmt or --output csv"))
+		})
+	})
+
+	Context("when parsing json payloads", func() {
+		var payloads []string
+
+		BeforeEach(func() {
+			payloads = []string{
+				`{"level":"info","msg":"started","trace_id":"abc"}`,
+				`not json`,
+				`{"level":"error","msg":"request failed","http":{"status":500},"trace_id":"def"}`,
+			}
+			httpClient.responseBody = []string{payloadResponseBody(startTime, payloads...)}
+		})
+
+		It("writes the selected fields of json payloads", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--parse-json", "--fields", "level, msg,http.status", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT level=info msg=started", startTime.Format(timeFormat)),
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT not json", startTime.Add(time.Second).Format(timeFormat)),
+				fmt.Sprintf(`   %s [APP/PROC/WEB/0] OUT level=error msg="request failed" http.status=500`, startTime.Add(2*time.Second).Format(timeFormat)),
+			}))
+		})
+
+		It("filters by the fields of json payloads", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--parse-json", "--where", "level=error", "--where", "http.status=500", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT %s", startTime.Add(2*time.Second).Format(timeFormat), payloads[2]),
+			}))
+		})
+
+		It("embeds json payloads as objects in json output", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--parse-json", "--json-lines", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			lines := writer.lines()
+			Expect(lines).To(HaveLen(3))
+
+			logJSON := `{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":%s,"type":"OUT"}}`
+			Expect(lines[0]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.UnixNano(), payloads[0])))
+			Expect(lines[1]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.Add(time.Second).UnixNano(), `"not json"`)))
+			Expect(lines[2]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.Add(2*time.Second).UnixNano(), payloads[2])))
+		})
+
+		It("fatally logs if --where is used without --parse-json", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--where", "level=error", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--fields and --where require --parse-json"))
+		})
+
+		It("fatally logs if a where filter is invalid", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--parse-json", "--where", "level", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("invalid where filter 'level'. Ensure your where filter is in the format key=value"))
+		})
+	})
+
+	Context("when stitching multi-line records", func() {
+		It("writes the lines of a stack trace as a single envelope", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime,
+				"java.lang.IllegalStateException: boom",
+				"\tat com.example.Foo.bar(Foo.java:10)",
+				"Caused by: java.lang.NullPointerException",
+				"\t... 3 more",
+				"request served",
+			)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--multiline", "--json-lines", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			lines := writer.lines()
+			Expect(lines).To(HaveLen(2))
+
+			logJSON := `{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":%q,"type":"OUT"}}`
+			Expect(lines[0]).To(MatchJSON(fmt.Sprintf(logJSON,
+				startTime.UnixNano(),
+				"java.lang.IllegalStateException: boom\n\tat com.example.Foo.bar(Foo.java:10)\nCaused by: java.lang.NullPointerException\n\t... 3 more",
+			)))
+			Expect(lines[1]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.Add(4*time.Second).UnixNano(), "request served")))
+		})
+
+		It("stitches OUT and ERR lines into separate records", func() {
+			logJSON := `{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":%q,"type":%q}}`
+			logs := []struct{ logType, payload string }{
+				{"ERR", "java.lang.IllegalStateException: boom"},
+				{"ERR", "\tat com.example.Foo.bar(Foo.java:10)"},
+				{"OUT", "request served"},
+				{"ERR", "\tat com.example.Foo.baz(Foo.java:20)"},
+			}
+			var envelopes []string
+			for i := len(logs) - 1; i >= 0; i-- {
+				payload := base64.StdEncoding.EncodeToString([]byte(logs[i].payload))
+				envelopes = append(envelopes, fmt.Sprintf(logJSON, startTime.Add(time.Duration(i)*100*time.Millisecond).UnixNano(), payload, logs[i].logType))
+			}
+			httpClient.responseBody = []string{fmt.Sprintf(`{"envelopes":{"batch":[%s]}}`, strings.Join(envelopes, ","))}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--multiline", "--json-lines", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			lines := writer.lines()
+			Expect(lines).To(HaveLen(2))
+			Expect(lines[0]).To(MatchJSON(fmt.Sprintf(logJSON,
+				startTime.UnixNano(),
+				"java.lang.IllegalStateException: boom\n\tat com.example.Foo.bar(Foo.java:10)\n\tat com.example.Foo.baz(Foo.java:20)",
+				"ERR",
+			)))
+			Expect(lines[1]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.Add(200*time.Millisecond).UnixNano(), "request served", "OUT")))
+		})
+
+		It("writes held records before later metrics", func() {
+			logJSON := `{"timestamp":"%d","source_id":"app-name","instance_id":"0","log":{"payload":%q,"type":"OUT"}}`
+			counterJSON := `{"timestamp":"%d","source_id":"app-name","instance_id":"0","counter":{"name":"some-name","total":99}}`
+			// NOTE: These are in descending order.
+			envelopes := []string{
+				fmt.Sprintf(logJSON, startTime.Add(300*time.Millisecond).UnixNano(), base64.StdEncoding.EncodeToString([]byte("request served"))),
+				fmt.Sprintf(counterJSON, startTime.Add(200*time.Millisecond).UnixNano()),
+				fmt.Sprintf(logJSON, startTime.Add(100*time.Millisecond).UnixNano(), base64.StdEncoding.EncodeToString([]byte("\tat main.go:12"))),
+				fmt.Sprintf(logJSON, startTime.UnixNano(), base64.StdEncoding.EncodeToString([]byte("panic: boom"))),
+			}
+			httpClient.responseBody = []string{fmt.Sprintf(`{"envelopes":{"batch":[%s]}}`, strings.Join(envelopes, ","))}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--multiline", "--output-format", "{{.Timestamp}} {{payload .}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("%d panic: boom", startTime.UnixNano()),
+				"\tat main.go:12",
+				fmt.Sprintf("%d ", startTime.Add(200*time.Millisecond).UnixNano()),
+				fmt.Sprintf("%d request served", startTime.Add(300*time.Millisecond).UnixNano()),
+			}))
+		})
+
+		It("starts records with lines that match --multiline-start", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime,
+				"2024-01-01 ERROR failed",
+				"not indented",
+				"2024-01-01 INFO done",
+			)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--multiline", "--multiline-start", `^\d{4}-`, "--output-format", "{{payload .}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				"2024-01-01 ERROR failed",
+				"not indented",
+				"2024-01-01 INFO done",
+			}))
+			Expect(strings.Count(string(writer.bytes), "\n")).To(Equal(3))
+		})
+
+		It("does not stitch lines read after the timeout", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime,
+				"first",
+				"  continued",
+			)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--multiline", "--multiline-timeout", "500ms", "--output-format", "[{{payload .}}]", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{"[first]", "[  continued]"}))
+		})
+
+		It("fatally logs if --multiline-start is used without --multiline", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--multiline-start", "^E", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--multiline-start and --multiline-timeout require --multiline"))
+		})
+
+		It("fatally logs if --multiline-start is not a valid regex", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--multiline", "--multiline-start", "(", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("invalid multiline start pattern '('. Ensure your pattern is a valid regex"))
+		})
+	})
+
+	Context("when choosing the time zone and format", func() {
+		It("writes timestamps in the given time zone and format", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--timezone", "utc", "--time-format", "rfc3339nano", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			logFormat := "   %s [APP/PROC/WEB/0] %s log body"
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.UTC().Format(time.RFC3339Nano), "ERR"),
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).UTC().Format(time.RFC3339Nano), "OUT"),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).UTC().Format(time.RFC3339Nano), "OUT"),
+			}))
+		})
+
+		It("writes timestamps with a layout in an IANA time zone", func() {
+			location, err := time.LoadLocation("America/New_York")
+			Expect(err).ToNot(HaveOccurred())
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--timezone", "America/New_York", "--time-format", "2006-01-02 15:04:05 MST", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()[0]).To(Equal(fmt.Sprintf(
+				"   %s [APP/PROC/WEB/0] ERR log body",
+				startTime.In(location).Format("2006-01-02 15:04:05 MST"),
+			)))
+		})
+
+		It("writes timestamps as UNIX seconds", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--time-format", "unix", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()[0]).To(Equal(fmt.Sprintf("   %d.000000000 [APP/PROC/WEB/0] ERR log body", startTime.Unix())))
+		})
+
+		It("writes timestamps relative to now", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--time-format", "relative", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			for _, line := range writer.lines() {
+				Expect(line).To(MatchRegexp(`^   (1m\d+s|\d+s) ago \[APP/PROC/WEB/0\] (ERR|OUT) log body$`))
+			}
+		})
+
+		It("applies to logfmt and csv timestamps", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output", "csv", "--columns", "timestamp", "--time-format", "unix", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()[1]).To(Equal(fmt.Sprintf("%d.000000000", startTime.Unix())))
+		})
+
+		It("applies to the template timestamp function", func() {
+			httpClient.responseBody = []string{responseBody(time.Unix(1500000000, 0))}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--timezone", "UTC", "--time-format", "15:04:05", "--output-format", "{{timestamp .Timestamp}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()[0]).To(Equal("02:40:00"))
+		})
+
+		It("formats template timestamps as RFC 3339 by default", func() {
+			httpClient.responseBody = []string{responseBody(time.Unix(1500000000, 0))}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--timezone", "UTC", "--output-format", "{{timestamp .Timestamp}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()[0]).To(Equal("2017-07-14T02:40:00Z"))
+		})
+
+		It("applies the time zone to template time functions", func() {
+			httpClient.responseBody = []string{responseBody(time.Unix(1500000000, 0))}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--timezone", "UTC", "--output-format", `{{formatTime "15:04" .Timestamp}} {{(time .Timestamp).Location}}`, "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()[0]).To(Equal("02:40 UTC"))
+		})
+
+		It("fatally logs if the time zone is unknown", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--timezone", "Mars/Olympus_Mons", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("couldn't parse --timezone: unknown time zone: Mars/Olympus_Mons"))
+		})
+
+		It("fatally logs if the time format has no layout elements", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--time-format", "fancy", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("couldn't parse --time-format: invalid time format: fancy"))
+		})
+	})
+
+	Context("when writing statistics", func() {
+		It("summarizes the envelopes instead of writing them", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime,
+				"GET /v2/apps/3fa85f64-5717-4562-b3fc-2c963f66afa6 200 in 12ms",
+				"started",
+				"GET /v2/apps/9b2c1e40-7d3a-4f5e-8c6b-1a2b3c4d5e6f 200 in 7ms",
+			)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--stats", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				"Envelopes:        3 over 2s",
+				"Logs:             3 (OUT 3, ERR 0, 0.0% ERR)",
+				"Logs per second:  1.50",
+				"",
+				"Instances:",
+				"  0  3",
+				"",
+				"Source types:",
+				"  APP/PROC/WEB  3",
+				"",
+				"Top messages:",
+				"  2  GET /v<n>/apps/<guid> <n> in <n>ms",
+				"  1  started",
+			}))
+		})
+
+		It("includes the ratio of ERR logs", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--stats", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(ContainElement("Logs:             3 (OUT 2, ERR 1, 33.3% ERR)"))
+		})
+
+		It("includes timer percentiles", func() {
+			httpClient.responseBody = []string{timerResponseBody(startTime)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--stats", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(ContainElements(
+				"Timers:",
+				"  NAME  COUNT  P50  P95  P99",
+				"  http  1      1s   1s   1s",
+			))
+		})
+
+		It("names instances by source when tailing more than one", func() {
+			httpClient.responseBody = []string{
+				sourceResponseBody("guid-a", startTime),
+				sourceResponseBody("guid-b", startTime.Add(time.Second)),
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--stats", "guid-a", "guid-b"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(ContainElements("  guid-a/0  1", "  guid-b/0  1"))
+		})
+
+		It("fatally logs if used with --json", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--stats", "--json", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--stats cannot be used with --json, --json-lines, --output or --output-format"))
+		})
+
+		It("fatally logs if --stats-interval is used without following", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--stats", "--stats-interval", "1m", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--stats-interval requires --stats and --follow"))
+		})
+	})
+
+	Context("when deduplicating repeated logs", func() {
+		It("collapses consecutive repeated logs into one line", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime,
+				"crash",
+				"crash",
+				"crash",
+				"restarting",
+				"crash",
+			)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--dedupe", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT crash (repeated 3 times)", startTime.Format(timeFormat)),
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT restarting", startTime.Add(3*time.Second).Format(timeFormat)),
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT crash", startTime.Add(4*time.Second).Format(timeFormat)),
+			}))
+		})
+
+		It("includes the repeat count in JSON", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime,
+				"crash",
+				"crash",
+				"restarting",
+			)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--dedupe", "--json-lines", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			lines := writer.lines()
+			Expect(lines).To(HaveLen(2))
+
+			logJSON := `{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":%q,"type":"OUT"}%s}`
+			Expect(lines[0]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.UnixNano(), "crash", `,"repeated":2`)))
+			Expect(lines[1]).To(MatchJSON(fmt.Sprintf(logJSON, startTime.Add(2*time.Second).UnixNano(), "restarting", "")))
+		})
+
+		It("writes held logs before later envelopes", func() {
+			counterJSON := `{"source_id":"app-name","instance_id":"0","timestamp":"%d","counter":{"name":"restarts","total":1}}`
+			logJSON := `{"timestamp":"%d","source_id":"app-name","instance_id":"1","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":%q}}`
+			// NOTE: Read responses are in descending order.
+			httpClient.responseBody = []string{fmt.Sprintf(`{"envelopes":{"batch":[%s,%s,%s]}}`,
+				fmt.Sprintf(counterJSON, startTime.Add(2*time.Second).UnixNano()),
+				fmt.Sprintf(logJSON, startTime.Add(1*time.Second).UnixNano(), base64.StdEncoding.EncodeToString([]byte("crash"))),
+				fmt.Sprintf(logJSON, startTime.UnixNano(), base64.StdEncoding.EncodeToString([]byte("crash"))),
+			)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--dedupe", "--output-format", "{{.Timestamp}} {{.Repeated}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("%d 2", startTime.UnixNano()),
+				fmt.Sprintf("%d 1", startTime.Add(2*time.Second).UnixNano()),
+			}))
+		})
+
+		It("exposes the repeat count to output templates", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime,
+				"crash",
+				"crash",
+			)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--dedupe", "--output-format", "{{payload .}} x{{.Repeated}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{"crash x2"}))
+		})
+
+		It("fatally logs if --dedupe-timeout is used without --dedupe", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--dedupe-timeout", "1s", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--dedupe-timeout requires --dedupe"))
+		})
+
+		It("fatally logs if --dedupe is used with --stats", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--dedupe", "--stats", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--dedupe cannot be used with --stats"))
+		})
+	})
+
+	Context("when limiting or sampling envelopes", func() {
+		It("drops envelopes beyond --max-rate and reports them on exit", func() {
+			payloads := make([]string, 10)
+			for i := range payloads {
+				payloads[i] = fmt.Sprintf("request %d", i)
+			}
+			httpClient.responseBody = []string{payloadResponseBody(startTime, payloads...)}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+			command.Tail(
+				ctx,
+				cliConn,
+				[]string{"--follow", "--max-rate", "3/s", "--output-format", "{{payload .}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{"request 0", "request 1", "request 2"}))
+			Expect(logger.printfMessages).To(ContainElement("Dropped 7 envelopes in total exceeding --max-rate 3/s"))
+		})
+
+		It("writes a sample of the envelopes", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime, "a", "b", "c", "d", "e")}
+			random := []float64{0.1, 0.5, 0.9, 0.49, 0.7}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--sample", "0.5", "--output-format", "{{payload .}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+				command.WithTailRandom(func() float64 {
+					r := random[0]
+					random = random[1:]
+					return r
+				}),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{"a", "d"}))
+			Expect(logger.printfMessages).To(ContainElement("Dropped 3 envelopes in total outside of --sample 0.5"))
+		})
+
+		It("writes every envelope with --sample 1", func() {
+			httpClient.responseBody = []string{payloadResponseBody(startTime, "a", "b", "c")}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--sample", "1", "--output-format", "{{payload .}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{"a", "b", "c"}))
+			Expect(logger.printfMessages).ToNot(ContainElement(HavePrefix("Dropped")))
+		})
+
+		It("fatally logs if --max-rate is used without following", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--max-rate", "10/s", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--max-rate requires --follow"))
+		})
+
+		It("fatally logs if --max-rate is invalid", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--follow", "--max-rate", "fast", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("invalid max rate 'fast'. Ensure your max rate is a positive number of envelopes per second, such as 100/s"))
+		})
+
+		It("fatally logs if --sample is out of range", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--sample", "1.5", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("invalid sample '1.5'. Ensure your sample is a number greater than 0 and at most 1"))
+		})
+	})
+
+	Context("when writing to output files", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = os.MkdirTemp("", "output-file")
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(os.RemoveAll, dir)
+		})
+
+		readFile := func(path string) []string {
+			data, err := os.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+		}
+
+		It("writes the envelopes to the file instead of the writer", func() {
+			path := filepath.Join(dir, "out.log")
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output-file", path, "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+				command.WithTailColor(),
+			)
+
+			Expect(writer.bytes).To(BeEmpty())
+			logFormat := "   %s [APP/PROC/WEB/0] %s log body"
+			Expect(readFile(path)).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Format(timeFormat), "ERR"),
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).Format(timeFormat), "OUT"),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat), "OUT"),
+			}))
+		})
+
+		It("writes json batches to the file", func() {
+			path := filepath.Join(dir, "out.json")
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output-file", path, "--json", "app-name"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			data, err := os.ReadFile(path)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(strings.Count(string(data), `"timestamp"`)).To(Equal(3))
+			Expect(string(data)).To(HavePrefix(`{"batch":[`))
+		})
+
+		It("writes the envelopes of each source to their own file", func() {
+			path := filepath.Join(dir, "out.log")
+			cliConn.cliCommandResult = [][]string{{"guid-a"}, {"guid-b"}}
+			httpClient.responseBody = []string{
+				sourceResponseBody("guid-a", startTime.Add(2*time.Second), startTime),
+				sourceResponseBody("guid-b", startTime.Add(1*time.Second)),
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output-file", path, "app-a", "app-b"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			logFormat := "   %s [%s APP/PROC/WEB/0] OUT log body"
+			Expect(readFile(filepath.Join(dir, "out.app-a.log"))).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Format(timeFormat), "app-a"),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat), "app-a"),
+			}))
+			Expect(readFile(filepath.Join(dir, "out.app-b.log"))).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).Format(timeFormat), "app-b"),
+			}))
+			Expect(writer.lines()).To(Equal([]string{
+				"Retrieving logs for sources app-a, app-b in org  / space  as ...",
+			}))
+		})
+
+		It("rotates and compresses files that grow too large", func() {
+			path := filepath.Join(dir, "out.log")
+			httpClient.responseBody = []string{
+				payloadResponseBody(startTime, "a", "b", "c", "d", "e", "f"),
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output-file", path, "--max-file-size", "100", "--gzip", "--output-format", "{{.Timestamp}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			rotated, err := filepath.Glob(path + ".*.gz")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rotated).To(HaveLen(1))
+
+			f, err := os.Open(rotated[0])
+			Expect(err).ToNot(HaveOccurred())
+			defer f.Close()
+			zr, err := gzip.NewReader(f)
+			Expect(err).ToNot(HaveOccurred())
+			data, err := io.ReadAll(zr)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(data)).To(Equal(fmt.Sprintf("%d\n%d\n%d\n%d\n%d\n",
+				startTime.UnixNano(),
+				startTime.Add(1*time.Second).UnixNano(),
+				startTime.Add(2*time.Second).UnixNano(),
+				startTime.Add(3*time.Second).UnixNano(),
+				startTime.Add(4*time.Second).UnixNano(),
+			)))
+			Expect(readFile(path)).To(HaveLen(1))
+		})
+
+		It("starts every new csv file with the columns", func() {
+			path := filepath.Join(dir, "out.csv")
+			httpClient.responseBody = []string{
+				payloadResponseBody(startTime, "a", "b", "c"),
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output-file", path, "--max-file-size", "70", "--output", "csv", "--columns", "timestamp,payload", "--time-format", "unix", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			rotated, err := filepath.Glob(path + ".*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rotated).To(HaveLen(1))
+
+			row := func(i int, payload string) string {
+				return fmt.Sprintf("%d.000000000,%s", startTime.Add(time.Duration(i)*time.Second).Unix(), payload)
+			}
+			Expect(readFile(rotated[0])).To(Equal([]string{"timestamp,payload", row(0, "a"), row(1, "b")}))
+			Expect(readFile(path)).To(Equal([]string{"timestamp,payload", row(2, "c")}))
+		})
+
+		It("does not repeat the csv columns when appending to a file", func() {
+			path := filepath.Join(dir, "out.csv")
+			Expect(os.WriteFile(path, []byte("timestamp,payload\n1,old\n"), 0600)).To(Succeed())
+			httpClient.responseBody = []string{
+				payloadResponseBody(startTime, "a"),
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output-file", path, "--output", "csv", "--columns", "timestamp,payload", "--time-format", "unix", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(readFile(path)).To(Equal([]string{
+				"timestamp,payload",
+				"1,old",
+				fmt.Sprintf("%d.000000000,a", startTime.Unix()),
+			}))
+		})
+
+		It("flushes the file while following", func() {
+			path := filepath.Join(dir, "out.log")
+			httpClient.responseBody = []string{responseBody(startTime.Add(-30 * time.Second))}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				command.Tail(
+					ctx,
+					cliConn,
+					[]string{"--follow", "--output-file", path, "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}()
+
+			Eventually(func() int {
+				data, _ := os.ReadFile(path)
+				return strings.Count(string(data), "log body")
+			}).Should(Equal(3))
+
+			cancel()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("fatally logs if the file cannot be opened", func() {
+			path := filepath.Join(dir, "missing", "out.log")
+
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--output-file", path, "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(HavePrefix("failed to open output file: open " + path))
+			Expect(httpClient.requestURLs).To(BeEmpty())
+		})
+
+		It("fatally logs if the directory of the files of each source does not exist", func() {
+			path := filepath.Join(dir, "missing", "out.log")
+			cliConn.cliCommandResult = [][]string{{"guid-a"}, {"guid-b"}}
+
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--output-file", path, "app-a", "app-b"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(HavePrefix("failed to open output file: stat " + filepath.Join(dir, "missing")))
+		})
+
+		It("fatally logs if the file size is invalid", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--output-file", "out.log", "--max-file-size", "lots", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("couldn't parse --max-file-size: invalid file size: lots"))
+		})
+
+		It("fatally logs if rotation is configured without an output file", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--gzip", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--max-file-size, --rotate-interval and --gzip require --output-file"))
+		})
+	})
+
+	Context("when following with a checkpoint", func() {
+		var checkpointPath string
+
+		BeforeEach(func() {
+			dir, err := os.MkdirTemp("", "checkpoint")
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(os.RemoveAll, dir)
+			checkpointPath = filepath.Join(dir, "checkpoint.json")
+
+			cliConn.cliCommandResult = [][]string{
+				{"app-guid"},
+			}
+		})
+
+		It("records the last envelope written for each source", func() {
+			httpClient.responseBody = []string{
+				sourceResponseBody("app-guid", startTime.Add(2*time.Second), startTime.Add(1*time.Second)),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+
+			command.Tail(
+				ctx,
+				cliConn,
+				[]string{"--follow", "--checkpoint", checkpointPath, "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(HaveLen(2))
+			data, err := os.ReadFile(checkpointPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(MatchJSON(fmt.Sprintf(`{"app-guid":%d}`, startTime.Add(2*time.Second).UnixNano())))
+		})
+
+		It("does not record envelopes until everything before them is written", func() {
+			httpClient.responseBody = []string{
+				payloadResponseBody(startTime, "a", "a", "b"),
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				command.Tail(
+					ctx,
+					cliConn,
+					[]string{"--follow", "--dedupe", "--dedupe-timeout", "1h", "--checkpoint", checkpointPath, "app-name"},
+					httpClient,
+					logger,
+					writer,
+					command.WithTailNoHeaders(),
+				)
+			}()
+
+			// The last log is held in case it is repeated.
+			Eventually(func() string {
+				data, _ := os.ReadFile(checkpointPath)
+				return string(data)
+			}, 3*time.Second).Should(MatchJSON(fmt.Sprintf(`{"app-name":%d}`, startTime.Add(2*time.Second).UnixNano()-1)))
+
+			cancel()
+			Eventually(done).Should(BeClosed())
+
+			data, err := os.ReadFile(checkpointPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(MatchJSON(fmt.Sprintf(`{"app-name":%d}`, startTime.Add(2*time.Second).UnixNano())))
+		})
+
+		It("resumes following after the checkpoint without reading again", func() {
+			err := os.WriteFile(checkpointPath, []byte(fmt.Sprintf(`{"app-guid":%d}`, startTime.UnixNano())), 0600)
+			Expect(err).ToNot(HaveOccurred())
+
+			httpClient.responseBody = []string{
+				sourceResponseBody("app-guid", startTime.Add(1*time.Second), startTime.Add(2*time.Second)),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+
+			command.Tail(
+				ctx,
+				cliConn,
+				[]string{"--follow", "--checkpoint", checkpointPath, "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(httpClient.requestURLs).ToNot(BeEmpty())
+			requestURL, err := url.Parse(httpClient.requestURLs[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requestURL.Query().Get("descending")).To(BeEmpty())
+			Expect(requestURL.Query().Get("start_time")).To(Equal(strconv.FormatInt(startTime.UnixNano()+1, 10)))
+
+			logFormat := "   %s [APP/PROC/WEB/0] OUT log body"
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).Format(timeFormat)),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat)),
+			}))
+
+			data, err := os.ReadFile(checkpointPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(MatchJSON(fmt.Sprintf(`{"app-guid":%d}`, startTime.Add(2*time.Second).UnixNano())))
+		})
+
+		It("fatally logs if the checkpoint cannot be read", func() {
+			err := os.WriteFile(checkpointPath, []byte("not json"), 0600)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--follow", "--checkpoint", checkpointPath, "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(HavePrefix("failed to read checkpoint " + checkpointPath))
+		})
+
+		It("fatally logs if not following", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--checkpoint", checkpointPath, "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--checkpoint requires --follow"))
+		})
+	})
+
+	Context("when colorizing output", func() {
+		const (
+			reset  = "\x1b[0m"
+			bold   = "\x1b[1m"
+			dim    = "\x1b[2m"
+			red    = "\x1b[31m"
+			yellow = "\x1b[33m"
+			cyan   = "\x1b[36m"
+		)
+
+		It("colors the prefix and ERR logs", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+				command.WithTailColor(),
+			)
+
+			prefix := "   " + cyan + "%s" + reset + " " + bold + "[APP/PROC/WEB/0]" + reset + " "
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf(prefix, startTime.Format(timeFormat)) + red + "ERR log body" + reset,
+				fmt.Sprintf(prefix, startTime.Add(1*time.Second).Format(timeFormat)) + "OUT log body",
+				fmt.Sprintf(prefix, startTime.Add(2*time.Second).Format(timeFormat)) + "OUT log body",
+			}))
+		})
+
+		It("colors events and metrics", func() {
+			httpClient.responseBody = []string{mixedResponseBody(startTime)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+				command.WithTailColor(),
+			)
+
+			prefix := fmt.Sprintf("   "+cyan+"%s"+reset+" "+bold+"[app-name/0]"+reset+" ", startTime.Format(timeFormat))
+			Expect(writer.lines()).To(ContainElements(
+				prefix+dim+"COUNTER some-name:99"+reset,
+				prefix+dim+"TIMER http 0.000000 ms"+reset,
+				prefix+yellow+"EVENT some-title:some-body"+reset,
+			))
+		})
+
+		It("highlights --grep matches", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--grep", "bo", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+				command.WithTailColor(),
+			)
+
+			Expect(writer.lines()[0]).To(HaveSuffix(red + "ERR log \x1b[7mbo\x1b[27mdy" + reset))
+			Expect(writer.lines()[1]).To(HaveSuffix("OUT log \x1b[7mbo\x1b[27mdy"))
+		})
+
+		It("does not color output with --no-color", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--no-color", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+				command.WithTailColor(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] ERR log body", startTime.Format(timeFormat)),
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT log body", startTime.Add(1*time.Second).Format(timeFormat)),
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT log body", startTime.Add(2*time.Second).Format(timeFormat)),
+			}))
+		})
+
+		It("does not color json output", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--json", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailColor(),
+			)
+
+			Expect(string(writer.bytes)).ToNot(ContainSubstring("\x1b["))
+		})
+	})
+
+	Context("when separating stdout and stderr", func() {
+		It("only writes logs from the given stream", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--stream", "err", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] ERR log body", startTime.Format(timeFormat)),
+			}))
+		})
+
+		It("does not write envelopes other than logs", func() {
+			httpClient.responseBody = []string{mixedResponseBody(startTime)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--stream", "OUT", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT log body", startTime.Format(timeFormat)),
+			}))
+		})
+
+		It("writes ERR logs to the error writer with --stderr", func() {
+			errWriter := &stubWriter{}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--stderr", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+				command.WithTailErrWriter(errWriter),
+			)
+
+			logFormat := "   %s [APP/PROC/WEB/0] %s log body"
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).Format(timeFormat), "OUT"),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat), "OUT"),
+			}))
+			Expect(errWriter.lines()).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Format(timeFormat), "ERR"),
+			}))
+		})
+
+		It("includes the log type in json output", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--json", "app-name"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			logJSON := `{"timestamp":"%d","source_id":"app-name","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":"log body","type":"%s"}}`
+			Expect(writer.bytes).To(MatchJSON(fmt.Sprintf(`{"batch":[%s,%s,%s]}`,
+				fmt.Sprintf(logJSON, startTime.UnixNano(), "ERR"),
+				fmt.Sprintf(logJSON, startTime.Add(1*time.Second).UnixNano(), "OUT"),
+				fmt.Sprintf(logJSON, startTime.Add(2*time.Second).UnixNano(), "OUT"),
+			)))
+		})
+
+		It("fatally logs if the stream is invalid", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--stream", "both", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--stream must be OUT or ERR"))
+		})
+
+		It("fatally logs if --stderr is used with --json", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--stderr", "--json", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--stderr cannot be used with --json or --output-format"))
+		})
+	})
+
+	Context("when filtering by instance, source type or tag", func() {
+		BeforeEach(func() {
+			// NOTE: These are in descending order.
+			httpClient.responseBody = []string{fmt.Sprintf(`{"envelopes":{"batch":[%s,%s,%s,%s]}}`,
+				fmt.Sprintf(taggedEnvelopeTemplate, startTime.Add(3*time.Second).UnixNano(), "2", "APP/PROC/WEB", "app"),
+				fmt.Sprintf(taggedEnvelopeTemplate, startTime.Add(2*time.Second).UnixNano(), "1", "APP/PROC/WEB", "app"),
+				fmt.Sprintf(taggedEnvelopeTemplate, startTime.Add(1*time.Second).UnixNano(), "0", "RTR", "gorouter"),
+				fmt.Sprintf(taggedEnvelopeTemplate, startTime.UnixNano(), "0", "APP/PROC/WEB", "app"),
+			)}
+		})
+
+		It("only writes envelopes from the given instances", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--instance", "0,2", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT log body", startTime.Format(timeFormat)),
+				fmt.Sprintf("   %s [RTR/0] OUT log body", startTime.Add(1*time.Second).Format(timeFormat)),
+				fmt.Sprintf("   %s [APP/PROC/WEB/2] OUT log body", startTime.Add(3*time.Second).Format(timeFormat)),
+			}))
+		})
+
+		It("only writes envelopes with the given source types", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--source-type", "rtr", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [RTR/0] OUT log body", startTime.Add(1*time.Second).Format(timeFormat)),
+			}))
+		})
+
+		It("only writes envelopes with every given tag", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--tag", "origin=app", "--tag", "source_type=APP/PROC/WEB", "--instance", "1", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/1] OUT log body", startTime.Add(2*time.Second).Format(timeFormat)),
+			}))
+		})
+
+		It("matches deprecated tags", func() {
+			httpClient.responseBody = []string{deprecatedTagsResponseBody(startTime)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--source-type", "APP/PROC/WEB", "--tag", "source_type=APP/PROC/WEB", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(HaveLen(3))
+		})
+
+		It("fatally logs if a tag filter is invalid", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--tag", "origin", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("invalid tag filter 'origin'. Ensure your tag filter is in the format key=value"))
+		})
+	})
+
+	Context("when grepping", func() {
+		BeforeEach(func() {
+			httpClient.responseBody = []string{
+				payloadResponseBody(startTime, "GET /", "GET /boom", "panic: boom", "\tat main.go:12", "GET /ok"),
+			}
+		})
+
+		It("only writes logs that match --grep", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--grep", "boom", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			logFormat := "   %s [APP/PROC/WEB/0] OUT %s"
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).Format(timeFormat), "GET /boom"),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat), "panic: boom"),
+			}))
+		})
+
+		It("does not write logs that match --grep-v", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--grep-v", "^GET", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			logFormat := "   %s [APP/PROC/WEB/0] OUT %s"
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat), "panic: boom"),
+				fmt.Sprintf(logFormat, startTime.Add(3*time.Second).Format(timeFormat), "\tat main.go:12"),
+			}))
+		})
+
+		It("combines --grep and --grep-v", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--grep", "boom", "--grep-v", "^GET", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT panic: boom", startTime.Add(2*time.Second).Format(timeFormat)),
+			}))
+		})
+
+		It("writes the envelopes before and after each match", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--grep", "^panic", "-B", "1", "-A", "1", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			logFormat := "   %s [APP/PROC/WEB/0] OUT %s"
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).Format(timeFormat), "GET /boom"),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat), "panic: boom"),
+				fmt.Sprintf(logFormat, startTime.Add(3*time.Second).Format(timeFormat), "\tat main.go:12"),
+			}))
+		})
+
+		It("matches the payload after new line substitution", func() {
+			httpClient.responseBody = []string{
+				payloadResponseBody(startTime, "GET /", "first second"),
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--new-line", "--grep", `first\nsecond`, "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT first", startTime.Add(1*time.Second).Format(timeFormat)),
+				"second",
+			}))
+		})
+
+		It("matches the title and body of events but not metrics", func() {
+			httpClient.responseBody = []string{mixedResponseBody(startTime)}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--grep", "some-body", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [app-name/0] EVENT some-title:some-body", startTime.Format(timeFormat)),
+			}))
+		})
+
+		It("filters envelopes while following", func() {
+			httpClient.responseBody = []string{
+				payloadResponseBodyAsc(startTime, "GET /", "panic: boom", "GET /ok"),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+			defer cancel()
+
+			command.Tail(
+				ctx,
+				cliConn,
+				[]string{"--follow", "--lines", "0", "--grep", "boom", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("   %s [APP/PROC/WEB/0] OUT panic: boom", startTime.Add(1*time.Second).Format(timeFormat)),
+			}))
+		})
+
+		It("fatally logs if the grep regex is invalid", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--grep-v", "*foo", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("invalid grep pattern '*foo'. Ensure your pattern is a valid regex"))
+		})
+
+		It("fatally logs if context is requested without a pattern", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"-A", "2", "app-name"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--before-context and --after-context require --grep or --grep-v"))
+		})
+	})
+
+	Context("when more than 1000 lines are requested", func() {
+		var timestamps []time.Time
+
+		BeforeEach(func() {
+			cliConn.cliCommandResult = [][]string{
+				{"app-guid"},
+			}
+
+			timestamps = nil
+			for i := 0; i < 1500; i++ {
+				timestamps = append(timestamps, startTime.Add(time.Duration(i)*time.Millisecond))
+			}
+
+			// NOTE: Read responses are in descending order. The second page
+			// repeats the oldest envelope of the first page.
+			httpClient.responseBody = []string{
+				sourceResponseBody("app-guid", descending(timestamps[500:])...),
+				sourceResponseBody("app-guid", descending(timestamps[:501])...),
+			}
+		})
+
+		It("pages backwards and streams the envelopes in ascending order", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--lines", "1500", "--output-format", "{{.Timestamp}}", "app-name"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			var expected []string
+			for _, ts := range timestamps {
+				expected = append(expected, strconv.FormatInt(ts.UnixNano(), 10))
+			}
+			Expect(writer.lines()).To(Equal(expected))
+
+			Expect(httpClient.requestURLs).To(HaveLen(2))
+			var limits, ends []string
+			for _, u := range httpClient.requestURLs {
+				requestURL, err := url.Parse(u)
+				Expect(err).ToNot(HaveOccurred())
+				limits = append(limits, requestURL.Query().Get("limit"))
+				ends = append(ends, requestURL.Query().Get("end_time"))
+			}
+			Expect(limits).To(Equal([]string{"1000", "501"}))
+			Expect(ends[1]).To(Equal(strconv.FormatInt(timestamps[500].UnixNano()+1, 10)))
+		})
+
+		It("stops paging at the start of the range", func() {
+			httpClient.responseBody = []string{
+				sourceResponseBody("app-guid", descending(timestamps[500:])...),
+				sourceResponseBody("app-guid", descending(timestamps[400:501])...),
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--lines", "1500", "--json", "app-name"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			Expect(httpClient.requestURLs).To(HaveLen(2))
+			Expect(strings.Count(string(writer.bytes), `"timestamp"`)).To(Equal(1100))
+		})
+
+		It("reads every page once when writing json", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--lines", "1500", "--json", "app-name"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			Expect(httpClient.requestURLs).To(HaveLen(2))
+			Expect(strings.Count(string(writer.bytes), `"timestamp"`)).To(Equal(1500))
+		})
+
+		It("streams every source and merges the envelopes by timestamp", func() {
+			cliConn.cliCommandResult = [][]string{
+				{"guid-a"},
+				{"guid-b"},
+			}
+
+			var timestampsA, timestampsB []time.Time
+			for i, ts := range timestamps {
+				if i%2 == 0 {
+					timestampsA = append(timestampsA, ts)
+				} else {
+					timestampsB = append(timestampsB, ts)
+				}
+			}
+			httpClient.pathResponseBody = map[string][]string{
+				"/v1/read/guid-a": {
+					sourceResponseBody("guid-a", descending(timestampsA)...),
+				},
+				"/v1/read/guid-b": {
+					sourceResponseBody("guid-b", descending(timestampsB)...),
+				},
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--lines", "1500", "--output-format", "{{.Timestamp}}", "app-a", "app-b"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			var expected []string
+			for _, ts := range timestamps {
+				expected = append(expected, strconv.FormatInt(ts.UnixNano(), 10))
+			}
+			Expect(writer.lines()).To(Equal(expected))
+
+			var paths []string
+			for _, u := range httpClient.requestURLs {
+				requestURL, err := url.Parse(u)
+				Expect(err).ToNot(HaveOccurred())
+				paths = append(paths, requestURL.Path)
+			}
+			Expect(paths).To(ConsistOf("/v1/read/guid-a", "/v1/read/guid-b"))
+		})
+	})
+
+	Context("when multiple sources are given", func() {
+		BeforeEach(func() {
+			cliConn.cliCommandResult = [][]string{
+				{"guid-a"},
+				{"guid-b"},
+			}
+			cliConn.usernameResp = "a-user"
+			cliConn.orgName = "organization"
+			cliConn.spaceName = "space"
+
+			// NOTE: Read responses are in descending order.
+			httpClient.responseBody = []string{
+				sourceResponseBody("guid-a", startTime.Add(2*time.Second), startTime),
+				sourceResponseBody("guid-b", startTime.Add(3*time.Second), startTime.Add(1*time.Second)),
+			}
+		})
+
+		It("reads every source and merges the envelopes by timestamp", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"app-a", "app-b"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			var paths []string
+			for _, u := range httpClient.requestURLs {
+				requestURL, err := url.Parse(u)
+				Expect(err).ToNot(HaveOccurred())
+				paths = append(paths, requestURL.Path)
+			}
+			Expect(paths).To(ConsistOf("/v1/read/guid-a", "/v1/read/guid-b"))
+
+			Expect(cliConn.cliCommandArgs).To(Equal([][]string{
+				{"app", "app-a", "--guid"},
+				{"app", "app-b", "--guid"},
+			}))
+
+			logFormat := "   %s [%s APP/PROC/WEB/0] OUT log body"
+			Expect(writer.lines()).To(Equal([]string{
+				"Retrieving logs for sources app-a, app-b in org organization / space space as a-user...",
+				"",
+				fmt.Sprintf(logFormat, startTime.Format(timeFormat), "app-a"),
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).Format(timeFormat), "app-b"),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat), "app-a"),
+				fmt.Sprintf(logFormat, startTime.Add(3*time.Second).Format(timeFormat), "app-b"),
+			}))
+		})
+
+		It("ignores repeated sources", func() {
+			httpClient.responseBody = httpClient.responseBody[:1]
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"app-a", "app-a"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(cliConn.cliCommandArgs).To(HaveLen(1))
+			Expect(httpClient.requestURLs).To(HaveLen(1))
+		})
+
+		It("includes the source name in json output", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--json", "app-a", "app-b"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			logJSON := `{"timestamp":"%d","source_id":"%s","source_name":"%s","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":"log body","type":"OUT"}}`
+			Expect(writer.bytes).To(MatchJSON(fmt.Sprintf(`{"batch":[%s,%s,%s,%s]}`,
+				fmt.Sprintf(logJSON, startTime.UnixNano(), "guid-a", "app-a"),
+				fmt.Sprintf(logJSON, startTime.Add(1*time.Second).UnixNano(), "guid-b", "app-b"),
+				fmt.Sprintf(logJSON, startTime.Add(2*time.Second).UnixNano(), "guid-a", "app-a"),
+				fmt.Sprintf(logJSON, startTime.Add(3*time.Second).UnixNano(), "guid-b", "app-b"),
+			)))
+		})
+
+		It("includes the source name in json output for metrics", func() {
+			httpClient.responseBody = []string{
+				counterResponseBody(startTime),
+				emptyResponseBody(),
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--json", "app-a", "app-b"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			Expect(writer.bytes).To(MatchJSON(fmt.Sprintf(`{"batch":[
+				{"source_name":"app-name","timestamp":"%d","source_id":"app-name","instance_id":"0","deprecated_tags":{},"tags":{},"counter":{"name":"some-name","total":"99","delta":"0"}}
+			]}`, startTime.UnixNano())))
+		})
+
+		It("exposes the source name to output templates", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--output-format", "{{.SourceName}} {{.Timestamp}}", "app-a", "app-b"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf("app-a %d", startTime.UnixNano()),
+				fmt.Sprintf("app-b %d", startTime.Add(1*time.Second).UnixNano()),
+				fmt.Sprintf("app-a %d", startTime.Add(2*time.Second).UnixNano()),
+				fmt.Sprintf("app-b %d", startTime.Add(3*time.Second).UnixNano()),
+			}))
+		})
+
+		It("follows every source and merges the envelopes by timestamp", func() {
+			httpClient.responseBody = []string{
+				sourceResponseBody("guid-a", startTime, startTime.Add(2*time.Second)),
+				sourceResponseBody("guid-b", startTime.Add(1*time.Second), startTime.Add(3*time.Second)),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			command.Tail(
+				ctx,
+				cliConn,
+				[]string{"--follow", "--lines", "0", "app-a", "app-b"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			logFormat := "   %s [%s APP/PROC/WEB/0] OUT log body"
+			Expect(writer.lines()).To(Equal([]string{
+				fmt.Sprintf(logFormat, startTime.Format(timeFormat), "app-a"),
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).Format(timeFormat), "app-b"),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat), "app-a"),
+				fmt.Sprintf(logFormat, startTime.Add(3*time.Second).Format(timeFormat), "app-b"),
+			}))
+		})
+	})
+
+	Context("when tailing every app in a space or org", func() {
+		BeforeEach(func() {
+			cliConn.usernameResp = "a-user"
+			cliConn.orgName = "organization"
+			cliConn.orgGUID = "org-guid"
+			cliConn.spaceName = "space"
+			cliConn.spaceGUID = "space-guid"
+			cliConn.cliCommandResult = [][]string{
+				{`{"resources":[{"guid":"guid-a","name":"app-a"},{"guid":"guid-b","name":"app-b"}]}`},
+			}
+
+			// NOTE: Read responses are in descending order.
+			httpClient.responseBody = []string{
+				sourceResponseBody("guid-a", startTime.Add(2*time.Second), startTime),
+				sourceResponseBody("guid-b", startTime.Add(1*time.Second)),
+			}
+		})
+
+		It("tails every app in the targeted space", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--space"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			Expect(cliConn.cliCommandArgs).To(Equal([][]string{
+				{"curl", "/v3/apps?per_page=5000&space_guids=space-guid"},
+			}))
+
+			var paths []string
+			for _, u := range httpClient.requestURLs {
+				requestURL, err := url.Parse(u)
+				Expect(err).ToNot(HaveOccurred())
+				paths = append(paths, requestURL.Path)
+			}
+			Expect(paths).To(ConsistOf("/v1/read/guid-a", "/v1/read/guid-b"))
+
+			logFormat := "   %s [%s/0] OUT log body"
+			Expect(writer.lines()).To(Equal([]string{
+				"Retrieving logs for apps in org organization / space space as a-user...",
+				"",
+				fmt.Sprintf(logFormat, startTime.Format(timeFormat), "app-a"),
+				fmt.Sprintf(logFormat, startTime.Add(1*time.Second).Format(timeFormat), "app-b"),
+				fmt.Sprintf(logFormat, startTime.Add(2*time.Second).Format(timeFormat), "app-a"),
+			}))
+		})
+
+		It("reads every app with a single client", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--space"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			Expect(httpClient.requestURLs).To(HaveLen(2))
+			Expect(httpClient.infoRequests).To(Equal(2))
+		})
+
+		It("tails every app in the targeted org", func() {
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--org"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			Expect(cliConn.cliCommandArgs).To(Equal([][]string{
+				{"curl", "/v3/apps?per_page=5000&organization_guids=org-guid"},
+			}))
+			Expect(writer.lines()[0]).To(Equal("Retrieving logs for apps in org organization as a-user..."))
+			Expect(writer.lines()).To(HaveLen(5))
+		})
+
+		It("lists every page of apps", func() {
+			cliConn.cliCommandResult = [][]string{
+				{`{"pagination":{"next":{"href":"https://api.some-system.com/v3/apps?page=2&per_page=5000&space_guids=space-guid"}},"resources":[{"guid":"guid-a","name":"app-a"}]}`},
+				{`{"pagination":{"next":null},"resources":[{"guid":"guid-b","name":"app-b"}]}`},
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--space"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailNoHeaders(),
+			)
+
+			Expect(cliConn.cliCommandArgs).To(Equal([][]string{
+				{"curl", "/v3/apps?per_page=5000&space_guids=space-guid"},
+				{"curl", "/v3/apps?page=2&per_page=5000&space_guids=space-guid"},
+			}))
+			Expect(writer.lines()).To(HaveLen(3))
+		})
+
+		It("includes the app name in json output", func() {
+			cliConn.cliCommandResult = [][]string{
+				{`{"resources":[{"guid":"guid-a","name":"app-a"}]}`},
+			}
+
+			command.Tail(
+				context.Background(),
+				cliConn,
+				[]string{"--space", "--json"},
+				httpClient,
+				logger,
+				writer,
+			)
+
+			logJSON := `{"timestamp":"%d","source_id":"guid-a","source_name":"app-a","instance_id":"0","tags":{"source_type":"APP/PROC/WEB"},"log":{"payload":"log body","type":"OUT"}}`
+			Expect(writer.bytes).To(MatchJSON(fmt.Sprintf(`{"batch":[%s,%s]}`,
+				fmt.Sprintf(logJSON, startTime.UnixNano()),
+				fmt.Sprintf(logJSON, startTime.Add(2*time.Second).UnixNano()),
+			)))
+		})
+
+		It("follows apps that are pushed while following", func() {
+			cliConn.cliCommandResult = [][]string{
+				{`{"resources":[{"guid":"guid-a","name":"app-a"}]}`},
+				{`{"resources":[{"guid":"guid-a","name":"app-a"},{"guid":"guid-b","name":"app-b"}]}`},
+			}
+			httpClient.responseBody = nil
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+
+			command.Tail(
+				ctx,
+				cliConn,
+				[]string{"--space", "--follow", "--lines", "0"},
+				httpClient,
+				logger,
+				writer,
+				command.WithTailAppRefreshInterval(100*time.Millisecond),
+			)
+
+			var paths []string
+			for _, u := range httpClient.requestURLs {
+				requestURL, err := url.Parse(u)
+				Expect(err).ToNot(HaveOccurred())
+				paths = append(paths, requestURL.Path)
+			}
+			Expect(paths).To(ContainElements("/v1/read/guid-a", "/v1/read/guid-b"))
+			Expect(logger.printfMessages).To(ContainElement("Failed to refresh apps: INVALID TEST SETUP"))
+		})
+
+		It("fatally logs if there are no apps in the space", func() {
+			cliConn.cliCommandResult = [][]string{{`{"resources":[]}`}}
+
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--space"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("no apps found"))
+		})
+
+		It("fatally logs if the apps cannot be listed", func() {
+			cliConn.cliCommandErr = []error{errors.New("curl failed")}
+
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--org"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("failed to list apps: curl failed"))
+		})
+
+		It("fatally logs if sources are given with --space", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--space", "app-a"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("expected 0 arguments with --space or --org, got 1"))
+		})
+
+		It("fatally logs if --space and --org are both given", func() {
+			Expect(func() {
+				command.Tail(
+					context.Background(),
+					cliConn,
+					[]string{"--space", "--org"},
+					httpClient,
+					logger,
+					writer,
+				)
+			}).To(Panic())
+
+			Expect(logger.fatalfMessage).To(Equal("--space cannot be used with --org"))
+		})
+	})
+})
+
+func sourceResponseBody(sourceID string, timestamps ...time.Time) string {
+	var envelopes []string
+	for _, ts := range timestamps {
+		envelopes = append(envelopes, fmt.Sprintf(sourceEnvelopeTemplate, ts.UnixNano(), sourceID))
+	}
+	return fmt.Sprintf(`{"envelopes":{"batch":[%s]}}`, strings.Join(envelopes, ","))
+}
+
+// payloadResponseBody returns a response with a log for each payload, one
+// second apart from startTime, in descending order.
+func payloadResponseBody(startTime time.Time, payloads ...string) string {
+	envelopes := payloadEnvelopes(startTime, payloads)
+	for i, j := 0, len(envelopes)-1; i < j; i, j = i+1, j-1 {
+		envelopes[i], envelopes[j] = envelopes[j], envelopes[i]
+	}
+	return fmt.Sprintf(`{"envelopes":{"batch":[%s]}}`, strings.Join(envelopes, ","))
+}
+
+// payloadResponseBodyAsc is like payloadResponseBody but in ascending order.
+func payloadResponseBodyAsc(startTime time.Time, payloads ...string) string {
+	envelopes := payloadEnvelopes(startTime, payloads)
+	return fmt.Sprintf(`{"envelopes":{"batch":[%s]}}`, strings.Join(envelopes, ","))
+}
+
+func payloadEnvelopes(startTime time.Time, payloads []string) []string {
+	var envelopes []string
+	for i, payload := range payloads {
+		envelopes = append(envelopes, fmt.Sprintf(payloadEnvelopeTemplate,
+			startTime.Add(time.Duration(i)*time.Second).UnixNano(),
+			base64.StdEncoding.EncodeToString([]byte(payload)),
+		))
+	}
+	return envelopes
+}
+
+func descending(timestamps []time.Time) []time.Time {
+	reversed := make([]time.Time, 0, len(timestamps))
+	for i := len(timestamps) - 1; i >= 0; i-- {
+		reversed = append(reversed, timestamps[i])
+	}
+	return reversed
+}
+
+func responseBody(startTime time.Time) string {
+	// NOTE: These are in descending order.
+	return fmt.Sprintf(responseTemplate,
+		startTime.Add(2*time.Second).UnixNano(),
+		startTime.Add(1*time.Second).UnixNano(),
+		startTime.UnixNano(),
+	)
+}
+
+func responseBodyAsc(startTime time.Time) string {
+	// NOTE: These are in ascending order.
+	return fmt.Sprintf(responseTemplate,
+		startTime.UnixNano(),
+		startTime.Add(1*time.Second).UnixNano(),
+		startTime.Add(2*time.Second).UnixNano(),
+	)
+}
+
+func responseBodyWithNewLine(startTime time.Time, newLine rune) string {
+	// NOTE: These are in descending order.
+	payload := fmt.Sprintf("log%sbody", string(newLine))
+	encoded := base64.StdEncoding.EncodeToString([]byte(payload))
+	return fmt.Sprintf(responseTemplateWithNewLine,
+		encoded,
+		startTime.Add(2*time.Second).UnixNano(),
+		startTime.Add(1*time.Second).UnixNano(),
+		startTime.UnixNano(),
+	)
+}
+
+func responseBodyAscWithNewLine(startTime time.Time, newLine rune) string {
+	// NOTE: These are in ascending order.
+	payload := fmt.Sprintf("log%sbody", string(newLine))
+	encoded := base64.StdEncoding.EncodeToString([]byte(payload))
+	return fmt.Sprintf(responseTemplateWithNewLine,
+		encoded,
+		startTime.UnixNano(),
+		startTime.Add(1*time.Second).UnixNano(),
+		startTime.Add(2*time.Second).UnixNano(),
+	)
+}
+
+func deprecatedTagsResponseBody(startTime time.Time) string {
+	// NOTE: These are in descending order.
+	return fmt.Sprintf(deprecatedTagsResponseTemplate,
+		startTime.Add(2*time.Second).UnixNano(),
+		startTime.Add(1*time.Second).UnixNano(),
+		startTime.UnixNano(),
+	)
+}
+
+func counterResponseBody(startTime time.Time) string {
+	return fmt.Sprintf(counterResponseTemplate,
+		startTime.UnixNano(),
+	)
+}
+
+func gaugeResponseBody(startTime time.Time) string {
+	return fmt.Sprintf(gaugeResponseTemplate,
+		startTime.UnixNano(),
+	)
+}
+
+func timerResponseBody(startTime time.Time) string {
+	return fmt.Sprintf(timerResponseTemplate,
+		startTime.UnixNano(),
+		startTime.Add(1*time.Second).UnixNano(),
+		startTime.Add(2*time.Second).UnixNano(),
+	)
+}
+
+func eventResponseBody(startTime time.Time) string {
+	return fmt.Sprintf(eventResponseTemplate,
+		startTime.UnixNano(),
+	)
+}
+
+func mixedResponseBody(startTime time.Time) string {
+	return fmt.Sprintf(mixedResponseTemplate,
+		startTime.UnixNano(),
+		"0",
+	)
+}
+
+func mixedResponseBodyNoInstanceId(startTime time.Time) string {
+	return fmt.Sprintf(mixedResponseTemplate,
+		startTime.UnixNano(),
+		"",
+	)
+}
+
+func emptyResponseBody() string {
 	return `{ "envelopes": { "batch": [] } }`
 }
 
+var sourceEnvelopeTemplate = `{
+	"timestamp":"%d",
+	"source_id": %q,
+	"instance_id":"0",
+	"tags":{
+		"source_type":"APP/PROC/WEB"
+	},
+	"log":{
+		"payload":"bG9nIGJvZHk="
+	}
+}`
+
+var payloadEnvelopeTemplate = `{
+	"timestamp":"%d",
+	"source_id": "app-name",
+	"instance_id":"0",
+	"tags":{
+		"source_type":"APP/PROC/WEB"
+	},
+	"log":{
+		"payload":%q
+	}
+}`
+
+var taggedEnvelopeTemplate = `{
+	"timestamp":"%d",
+	"source_id": "app-name",
+	"instance_id":%q,
+	"tags":{
+		"source_type":%q,
+		"origin":%q
+	},
+	"log":{
+		"payload":"bG9nIGJvZHk="
+	}
+}`
+
 var responseTemplate = `{
 	"envelopes": {
 		"batch": [
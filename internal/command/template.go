@@ -0,0 +1,218 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// timeLayouts are the named layouts that can be given to formatTime in place
+// of a layout.
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"UnixDate":    time.UnixDate,
+	"RubyDate":    time.RubyDate,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"Stamp":       time.Stamp,
+	"StampMilli":  time.StampMilli,
+	"StampMicro":  time.StampMicro,
+	"StampNano":   time.StampNano,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// templateFuncs returns the functions available to output templates:
+//
+//	time TIMESTAMP                      the timestamp as a time.Time
+//	timestamp TIMESTAMP                 the timestamp formatted as given by --time-format
+//	formatTime LAYOUT [ZONE] TIMESTAMP  the timestamp formatted with the layout, which
+//	                                    may be named, such as "RFC3339", optionally in
+//	                                    another time zone
+//	payload ENVELOPE                    the payload of a log as a string
+//	tag NAME ENVELOPE                   the value of a tag, or of the deprecated tag if
+//	                                    there is no such tag
+//	json VALUE                          the value, or the envelope, as JSON
+//	upper STRING, lower STRING          the string in upper or lower case
+//	trunc LENGTH STRING                 the string cut to at most LENGTH characters
+//	duration ENVELOPE                   the duration of a timer
+//	gauge METRIC ENVELOPE               the value of a gauge metric
+//
+// Timestamps may be UNIX nanoseconds, such as .Timestamp, or a time.Time, and
+// are in the time zone of tf unless another is given. Envelopes are passed as
+// the template's data, such as ".".
+func templateFuncs(tf timestampFormat) template.FuncMap {
+	return template.FuncMap{
+		"time":       tf.templateTime,
+		"timestamp":  tf.templateTimestamp,
+		"formatTime": tf.formatTime,
+		"payload":    templatePayload,
+		"tag":        templateTag,
+		"json":       templateJSON,
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"trunc":      trunc,
+		"duration":   timerDuration,
+		"gauge":      gaugeValue,
+	}
+}
+
+func parseOutputFormat(f string, tf timestampFormat) (*template.Template, error) {
+	templ := template.New("OutputFormat").Funcs(templateFuncs(tf))
+	_, err := templ.Parse(f)
+	if err != nil {
+		return nil, err
+	}
+	return templ, nil
+}
+
+func (f timestampFormat) templateTime(ts interface{}) (time.Time, error) {
+	switch t := ts.(type) {
+	case int64:
+		return f.time(t), nil
+	case int:
+		return f.time(int64(t)), nil
+	case time.Time:
+		if f.location == nil {
+			return t, nil
+		}
+		return t.In(f.location), nil
+	default:
+		return time.Time{}, fmt.Errorf("expected a timestamp, got %T", ts)
+	}
+}
+
+func (f timestampFormat) templateTimestamp(ts interface{}) (string, error) {
+	t, err := f.templateTime(ts)
+	if err != nil {
+		return "", err
+	}
+	return f.format(t.UnixNano()), nil
+}
+
+func (f timestampFormat) formatTime(layout string, args ...interface{}) (string, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return "", fmt.Errorf("expected a layout, optional time zone and timestamp, got %d arguments", len(args)+1)
+	}
+
+	t, err := f.templateTime(args[len(args)-1])
+	if err != nil {
+		return "", err
+	}
+
+	if len(args) == 2 {
+		zone, ok := args[0].(string)
+		if !ok {
+			return "", fmt.Errorf("expected a time zone, got %T", args[0])
+		}
+
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return "", err
+		}
+		t = t.In(loc)
+	}
+
+	if named, ok := timeLayouts[layout]; ok {
+		layout = named
+	}
+
+	return t.Format(layout), nil
+}
+
+// templateArgEnvelope returns the envelope passed to a template function as
+// either the template's data or the envelope itself.
+func templateArgEnvelope(v interface{}) (*loggregator_v2.Envelope, error) {
+	switch e := v.(type) {
+	case templateEnvelope:
+		return e.Envelope, nil
+	case *loggregator_v2.Envelope:
+		return e, nil
+	default:
+		return nil, fmt.Errorf("expected an envelope, got %T", v)
+	}
+}
+
+func templatePayload(v interface{}) (string, error) {
+	e, err := templateArgEnvelope(v)
+	if err != nil {
+		return "", err
+	}
+
+	return string(e.GetLog().GetPayload()), nil
+}
+
+func templateTag(name string, v interface{}) (string, error) {
+	e, err := templateArgEnvelope(v)
+	if err != nil {
+		return "", err
+	}
+
+	value, _ := envelopeTag(e, name)
+	return value, nil
+}
+
+func templateJSON(v interface{}) (string, error) {
+	var (
+		output []byte
+		err    error
+	)
+	if e, envErr := templateArgEnvelope(v); envErr == nil {
+		output, err = jsonEnvelope(e, jsonOptions{})
+	} else {
+		output, err = json.Marshal(v)
+	}
+
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
+
+func trunc(length int, s string) string {
+	runes := []rune(s)
+	if length < 0 || len(runes) <= length {
+		return s
+	}
+	return string(runes[:length])
+}
+
+func timerDuration(v interface{}) (time.Duration, error) {
+	e, err := templateArgEnvelope(v)
+	if err != nil {
+		return 0, err
+	}
+
+	timer := e.GetTimer()
+	if timer == nil {
+		return 0, errors.New("envelope is not a timer")
+	}
+
+	return time.Duration(timer.GetStop() - timer.GetStart()), nil
+}
+
+func gaugeValue(metric string, v interface{}) (float64, error) {
+	e, err := templateArgEnvelope(v)
+	if err != nil {
+		return 0, err
+	}
+
+	value, ok := e.GetGauge().GetMetrics()[metric]
+	if !ok {
+		return 0, fmt.Errorf("envelope has no %s metric", metric)
+	}
+
+	return value.GetValue(), nil
+}
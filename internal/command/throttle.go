@@ -0,0 +1,144 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/go-loggregator/v10/rpc/loggregator_v2"
+)
+
+// dropNoticeInterval is how often a notice of the envelopes dropped by
+// --max-rate is written while following.
+const dropNoticeInterval = 10 * time.Second
+
+// throttle drops the envelopes that exceed --max-rate and those that are not
+// picked by --sample.
+type throttle struct {
+	// maxRate is the most envelopes kept each second, or 0 for no limit.
+	maxRate int
+	// sample is the probability that an envelope is kept, or 0 to keep
+	// every envelope.
+	sample float64
+	random func() float64
+
+	window time.Time
+	kept   int
+
+	// dropped counts the envelopes dropped by --max-rate since the last
+	// notice.
+	dropped  int
+	noticed  time.Time
+	overRate int
+	sampled  int
+}
+
+func newThrottle(o tailOptions) *throttle {
+	return &throttle{
+		maxRate: o.maxRate,
+		sample:  o.sample,
+		random:  o.random,
+		noticed: time.Now(),
+	}
+}
+
+// keep reports whether e is kept.
+func (t *throttle) keep(e *loggregator_v2.Envelope) bool {
+	if t.sample > 0 && t.random() >= t.sample {
+		t.sampled++
+		return false
+	}
+
+	if t.maxRate == 0 {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(t.window) >= time.Second {
+		t.window = now
+		t.kept = 0
+	}
+
+	if t.kept >= t.maxRate {
+		t.dropped++
+		t.overRate++
+		return false
+	}
+
+	t.kept++
+	return true
+}
+
+// notice returns how many envelopes were dropped by --max-rate since the
+// last notice, once the notice interval has passed.
+func (t *throttle) notice() (string, bool) {
+	if t.dropped == 0 || time.Since(t.noticed) < dropNoticeInterval {
+		return "", false
+	}
+
+	notice := fmt.Sprintf("Dropped %d envelopes exceeding --max-rate %d/s", t.dropped, t.maxRate)
+	t.dropped = 0
+	t.noticed = time.Now()
+	return notice, true
+}
+
+// summary returns how many envelopes were dropped in total.
+func (t *throttle) summary() []string {
+	var lines []string
+	if t.overRate > 0 {
+		lines = append(lines, fmt.Sprintf("Dropped %d envelopes in total exceeding --max-rate %d/s", t.overRate, t.maxRate))
+	}
+	if t.sampled > 0 {
+		lines = append(lines, fmt.Sprintf("Dropped %d envelopes in total outside of --sample %s", t.sampled, formatFloat(t.sample)))
+	}
+	return lines
+}
+
+// parseThrottle returns the most envelopes written each second and the
+// probability that an envelope is written.
+func parseThrottle(opts tailOptionFlags) (int, float64, error) {
+	if opts.MaxRate != "" && !opts.Follow {
+		return 0, 0, errors.New("--max-rate requires --follow")
+	}
+
+	maxRate, err := parseMaxRate(opts.MaxRate)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sample, err := parseSample(opts.Sample)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return maxRate, sample, nil
+}
+
+// parseMaxRate returns the most envelopes written each second, given as N/s
+// or N.
+func parseMaxRate(rate string) (int, error) {
+	if rate == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimSuffix(rate, "/s"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid max rate '%s'. Ensure your max rate is a positive number of envelopes per second, such as 100/s", rate)
+	}
+	return n, nil
+}
+
+// parseSample returns the probability that an envelope is written.
+func parseSample(sample string) (float64, error) {
+	if sample == "" {
+		return 0, nil
+	}
+
+	p, err := strconv.ParseFloat(sample, 64)
+	if err != nil || p <= 0 || p > 1 {
+		return 0, fmt.Errorf("invalid sample '%s'. Ensure your sample is a number greater than 0 and at most 1", sample)
+	}
+	return p, nil
+}
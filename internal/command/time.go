@@ -0,0 +1,154 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeArgument is a flag value holding a time in one of the formats accepted
+// by parseTime. Unlike a plain string flag, its value may begin with a dash so
+// that relative times such as "-2h" can be given as separate arguments.
+type timeArgument string
+
+// minUnixNanoseconds is the smallest integer time in nanoseconds, other than
+// 0, that is taken to be meant as nanoseconds. Smaller times are in early
+// 1970 and are most likely seconds or milliseconds.
+const minUnixNanoseconds = 1e15
+
+// IsValidValue implements flags.ValueValidator.
+func (timeArgument) IsValidValue(string) error {
+	return nil
+}
+
+// parseTime parses a time given as a command line argument. The accepted
+// formats are:
+//
+//   - an integer number of units since the UNIX epoch, e.g. seconds or
+//     nanoseconds depending on the command. Nanoseconds other than 0 that
+//     are too small to be meant as nanoseconds are rejected.
+//   - an RFC3339 timestamp, e.g. "2018-02-23T19:00:00Z"
+//   - "now"
+//   - a negative duration relative to now, e.g. "-2h" or "-15m30s"
+func parseTime(arg timeArgument, now time.Time, unit time.Duration) (time.Time, error) {
+	s := strings.TrimSpace(string(arg))
+
+	if strings.EqualFold(s, "now") {
+		return now, nil
+	}
+
+	if t, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if unit == time.Nanosecond && t != 0 && t > -minUnixNanoseconds && t < minUnixNanoseconds {
+			return time.Time{}, fmt.Errorf("invalid time: %s is too small to be UNIX nanoseconds. Ensure integer times are in nanoseconds, such as 1700000000000000000", s)
+		}
+		return time.Unix(0, t*int64(unit)), nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	if strings.HasPrefix(s, "-") {
+		if d, err := time.ParseDuration(s); err == nil {
+			return now.Add(d), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time format: %s", s)
+}
+
+// parseSince parses a positive duration such as "15m" and returns the time
+// that long before now.
+func parseSince(arg timeArgument, now time.Time) (time.Time, error) {
+	s := strings.TrimSpace(string(arg))
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid duration: %s", s)
+	}
+
+	return now.Add(-d), nil
+}
+
+const (
+	// unixTimeFormat writes timestamps as seconds since the UNIX epoch.
+	unixTimeFormat = "unix"
+	// relativeTimeFormat writes timestamps relative to now, e.g. "3s ago".
+	relativeTimeFormat = "relative"
+)
+
+// timestampFormat formats the timestamps of envelopes in a time zone with a
+// layout, as UNIX seconds or relative to now.
+type timestampFormat struct {
+	location *time.Location
+	layout   string
+}
+
+// format formats a timestamp given in UNIX nanoseconds.
+func (f timestampFormat) format(timestamp int64) string {
+	switch f.layout {
+	case unixTimeFormat:
+		return fmt.Sprintf("%d.%09d", timestamp/int64(time.Second), timestamp%int64(time.Second))
+	case relativeTimeFormat:
+		d := time.Since(time.Unix(0, timestamp)).Round(time.Second)
+		if d < 0 {
+			return "in " + (-d).String()
+		}
+		return d.String() + " ago"
+	default:
+		return f.time(timestamp).Format(f.layout)
+	}
+}
+
+// time returns a timestamp given in UNIX nanoseconds in the time zone.
+func (f timestampFormat) time(timestamp int64) time.Time {
+	t := time.Unix(0, timestamp)
+	if f.location == nil {
+		return t
+	}
+	return t.In(f.location)
+}
+
+// parseTimeFormat parses the value of --time-format, which is "unix",
+// "relative", the name of a layout such as "rfc3339nano", or a Go time
+// layout.
+func parseTimeFormat(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+
+	if strings.EqualFold(s, unixTimeFormat) || strings.EqualFold(s, relativeTimeFormat) {
+		return strings.ToLower(s), nil
+	}
+
+	for name, layout := range timeLayouts {
+		if strings.EqualFold(s, name) {
+			return layout, nil
+		}
+	}
+
+	// A layout without any elements to substitute formats every time as
+	// itself.
+	if time.Unix(0, 0).UTC().Format(s) == s {
+		return "", fmt.Errorf("invalid time format: %s", s)
+	}
+
+	return s, nil
+}
+
+// parseTimeZone parses the value of --timezone, which is "Local", "UTC" or
+// the name of an IANA time zone such as "America/New_York".
+func parseTimeZone(s string) (*time.Location, error) {
+	switch {
+	case s == "" || strings.EqualFold(s, "local"):
+		return time.Local, nil
+	case strings.EqualFold(s, "utc"):
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone: %s", s)
+	}
+	return loc, nil
+}
@@ -0,0 +1,126 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	logcache "code.cloudfoundry.org/go-log-cache/v3"
+)
+
+// clearScreen moves the cursor to the top left of the terminal and clears it.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// resultValue is the value of a series, or of a scalar or string, keyed by
+// the labels of the series.
+type resultValue struct {
+	key   string
+	value string
+}
+
+// watchQuery issues an instant query every interval until ctx is done. When
+// redrawing, each result replaces the last with the values that changed
+// highlighted. Otherwise each result is written after the last, preceded by
+// the time it was issued unless it is written as JSON.
+func watchQuery(ctx context.Context, client *logcache.Client, query string, o queryOptions, w io.Writer, log Logger) {
+	ticker := time.NewTicker(o.watch)
+	defer ticker.Stop()
+
+	var previous map[string]string
+	for {
+		res, err := runQuery(ctx, client, query, o)
+		if ctx.Err() != nil {
+			return
+		}
+
+		var b bytes.Buffer
+		var values []resultValue
+		var header int
+		if message, failed := queryFailure(res, err); failed {
+			fmt.Fprintln(&b, message)
+		} else {
+			writeQueryResult(&b, res, o, log)
+			if o.outputFormat() != jsonQueryOutput {
+				values, header = resultValues(res)
+			}
+		}
+
+		now := time.Now().Format(time.RFC3339)
+		switch {
+		case o.redraw:
+			fmt.Fprint(w, clearScreen)
+			fmt.Fprintf(w, "Every %s: %s    %s\n\n", o.watch, query, now)
+			_, _ = w.Write(highlightChanges(b.Bytes(), values, header, previous))
+		case o.outputFormat() == jsonQueryOutput:
+			_, _ = w.Write(b.Bytes())
+		default:
+			fmt.Fprintln(w, now)
+			_, _ = w.Write(b.Bytes())
+			fmt.Fprintln(w)
+		}
+
+		if values != nil {
+			previous = make(map[string]string, len(values))
+			for _, v := range values {
+				previous[v.key] = v.value
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resultValues returns the values of the result of an instant query in the
+// order they are written, and the number of lines written before them.
+func resultValues(res *logcache.PromQLQueryResult) ([]resultValue, int) {
+	switch res.Data.ResultType {
+	case "scalar", "string":
+		var p promqlPoint
+		if err := json.Unmarshal(res.Data.Result, &p); err != nil {
+			return nil, 0
+		}
+		return []resultValue{{value: p.value}}, 0
+	case "vector":
+		var series []promqlSeries
+		if err := json.Unmarshal(res.Data.Result, &series); err != nil {
+			return nil, 0
+		}
+
+		values := make([]resultValue, 0, len(series))
+		for _, s := range series {
+			values = append(values, resultValue{key: seriesLegend(s.Metric), value: s.Value.value})
+		}
+		return values, 1
+	default:
+		return nil, 0
+	}
+}
+
+// highlightChanges highlights the values at the end of each line of output
+// that differ from their previous values. Nothing is highlighted the first
+// time values are written.
+func highlightChanges(output []byte, values []resultValue, header int, previous map[string]string) []byte {
+	if previous == nil || len(values) == 0 {
+		return output
+	}
+
+	lines := strings.Split(string(output), "\n")
+	for i, v := range values {
+		n := header + i
+		if n >= len(lines) || previous[v.key] == v.value || !strings.HasSuffix(lines[n], v.value) {
+			continue
+		}
+
+		line := strings.TrimSuffix(lines[n], v.value)
+		lines[n] = line + highlightStart + v.value + highlightEnd
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
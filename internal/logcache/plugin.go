@@ -6,6 +6,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"code.cloudfoundry.org/cli/plugin"
 	"code.cloudfoundry.org/log-cache-cli/v4/internal/command"
@@ -36,13 +38,33 @@ func (lc *LogCache) Run(conn plugin.CliConnection, args []string) {
 	switch args[0] {
 	case "query":
 		var opts []command.QueryOption
-		command.Query(conn, args[1:], http.DefaultClient, l, os.Stdout, opts...)
+		if isTerminal {
+			opts = append(opts, command.WithQueryTable(), command.WithQueryRedraw())
+			if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+				opts = append(opts, command.WithQueryChartWidth(width))
+			}
+		}
+
+		// Stop watching on interrupt rather than exiting mid-redraw.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		command.Query(ctx, conn, args[1:], http.DefaultClient, l, os.Stdout, opts...)
 	case "tail":
-		var opts []command.TailOption
+		opts := []command.TailOption{command.WithTailErrWriter(os.Stderr)}
 		if !isTerminal {
 			opts = append(opts, command.WithTailNoHeaders())
 		}
-		command.Tail(context.Background(), conn, args[1:], http.DefaultClient, l, os.Stdout, opts...)
+		if isTerminal && os.Getenv("NO_COLOR") == "" {
+			opts = append(opts, command.WithTailColor())
+		}
+
+		// Stop following on interrupt so that Tail can finish writing, for
+		// example to save its checkpoint.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		command.Tail(ctx, conn, args[1:], http.DefaultClient, l, os.Stdout, opts...)
 	case "log-meta":
 		var opts []command.MetaOption
 		if !isTerminal {
@@ -59,19 +81,55 @@ func (lc *LogCache) GetMetadata() plugin.PluginMetadata {
 		Commands: []plugin.Command{
 			{
 				Name:     "tail",
-				HelpText: "Output logs for a source-id/app",
+				HelpText: "Output logs for one or more source-ids/apps",
 				UsageDetails: plugin.Usage{
-					Usage: `tail [options] <source-id/app>`,
+					Usage: `tail [options] <source-id/app>...`,
 					Options: map[string]string{
-						"-start-time":         "Start of query range in UNIX nanoseconds.",
-						"-end-time":           "End of query range in UNIX nanoseconds.",
+						"-start-time":         "Start of query range. Can be UNIX nanoseconds (cf query takes seconds), RFC3339, 'now', or relative to now such as '-2h'.",
+						"-end-time":           "End of query range. Can be UNIX nanoseconds (cf query takes seconds), RFC3339, 'now', or relative to now such as '-5m'. With --follow, only bounds the initial lines.",
+						"-since":              "Start of query range as a duration before now, such as '15m'. Cannot be used with --start-time.",
 						"-envelope-type, -t":  "Envelope type filter. Available filters: 'log', 'counter', 'gauge', 'timer', 'event', and 'any'.",
 						"-envelope-class, -c": "Envelope class filter. Available filters: 'logs', 'metrics', and 'any'.",
 						"-follow, -f":         "Output appended to stdout as logs are egressed.",
 						"-json":               "Output envelopes in JSON format.",
-						"-lines, -n":          "Number of envelopes to return. Default is 10.",
+						"-json-lines":         "Output envelopes in JSON format, one object per line, as they are read.",
+						"-output-format, -o":  "Format each envelope with a Go text/template. Functions such as formatTime, payload and tag are available, see the README.",
+						"-output":             "Output format. Available formats: 'pretty', 'json', 'ndjson', 'logfmt', and 'csv'. Cannot be used with --json, --json-lines or --output-format.",
+						"-columns":            "Comma separated fields written by logfmt and csv output: 'timestamp', 'source_id', 'source_name', 'instance_id', 'type', 'name', 'value', 'unit', 'payload', 'repeated', or the name of a tag.",
+						"-lines, -n":          "Number of envelopes to return per source. Default is 10.",
 						"-new-line":           "Character used for new line substition, must be single unicode character. Default is '\\n'.",
 						"-name-filter":        "Filters metrics by name.",
+						"-output-file":        "Write envelopes to the given file instead of stdout. When tailing more than one source, each source is written to its own file named after it.",
+						"-max-file-size":      "Rotate the output file once it would grow beyond the given size, such as '100M'. Requires --output-file.",
+						"-rotate-interval":    "Rotate the output file once it has been written to for the given duration, such as '1h'. Requires --output-file.",
+						"-gzip":               "Compress rotated output files with gzip. Requires --output-file.",
+						"-checkpoint":         "File used to resume following where it left off. The timestamp of the last envelope written for each source is saved to it. Requires --follow.",
+						"-stats":              "Write a summary of the envelopes instead of the envelopes: counts per instance and source type, the ratio of ERR logs, logs per second, the most repeated messages and timer percentiles.",
+						"-stats-interval":     "How often a summary of the envelopes since the last one is written while following, such as '1m'. Default is 10s. Requires --stats and --follow.",
+						"-timezone":           "Time zone of written timestamps: 'Local', 'UTC', or an IANA time zone such as 'America/New_York'. Default is 'Local'. Also applies to template time functions.",
+						"-time-format":        "Format of written timestamps: 'rfc3339', 'rfc3339nano', 'unix', 'relative' such as '3s ago', or a Go time layout such as '15:04:05.000'. With --output-format, used by the timestamp function.",
+						"-no-color":           "Do not colorize output. Output is only colorized on a terminal when NO_COLOR is not set.",
+						"-stream":             "Only output logs written to the given stream. Available streams: 'out' and 'err'.",
+						"-stderr":             "Write ERR logs to stderr instead of stdout. Cannot be used with --json or --output-format.",
+						"-instance":           "Only output envelopes from the given comma separated instance IDs, such as '0,2'.",
+						"-source-type":        "Only output envelopes with the given comma separated source types, such as 'RTR,APP/PROC/WEB'.",
+						"-tag":                "Only output envelopes with the given tag, in the format key=value. Can be repeated.",
+						"-parse-json":         "Parse log payloads that are JSON objects. With --json, they are written as objects instead of strings.",
+						"-fields":             "Comma separated fields of JSON payloads to write in place of the payload, such as 'level,msg'. Nested fields are named with dots. Requires --parse-json.",
+						"-where":              "Only output logs with a JSON payload whose field has the given value, in the format key=value. Can be repeated. Requires --parse-json.",
+						"-multiline":          "Join the logs of each instance that continue a record, such as the lines of a stack trace, into a single log. By default indented lines and lines starting with 'at ', 'Caused by' or '...' continue a record.",
+						"-multiline-start":    "Regex matching the logs that start a record. Every other log continues the record before it. Requires --multiline.",
+						"-multiline-timeout":  "How long a record waits for more lines before it is written, such as '500ms'. Default is 1s. Requires --multiline.",
+						"-dedupe":             "Collapse consecutive logs with the same payload from an instance into one, with the number of times it was repeated. Cannot be used with --stats.",
+						"-dedupe-timeout":     "How long a repeated log is held before it is written, such as '10s'. Default is 5s. Requires --dedupe.",
+						"-max-rate":           "Most envelopes written each second, such as '100/s'. Excess envelopes are dropped, with a notice of how many every 10s and in total on exit. Requires --follow.",
+						"-sample":             "Probability that each envelope is written, such as '0.1'. The number of envelopes dropped is reported on exit.",
+						"-grep":               "Only output logs and events whose text matches the regex. Matched after new line substitution.",
+						"-grep-v":             "Do not output logs and events whose text matches the regex.",
+						"-before-context, -B": "Number of envelopes to output before each match of --grep or --grep-v.",
+						"-after-context, -A":  "Number of envelopes to output after each match of --grep or --grep-v.",
+						"-space":              "Output logs for every app in the targeted space. Apps pushed while following are picked up every minute.",
+						"-org":                "Output logs for every app in the targeted org. Apps pushed while following are picked up every minute.",
 					},
 				},
 			},
@@ -94,10 +152,16 @@ func (lc *LogCache) GetMetadata() plugin.PluginMetadata {
 				UsageDetails: plugin.Usage{
 					Usage: `query <promql-query> [options]`,
 					Options: map[string]string{
-						"-time":  "Effective time for query execution of an instant query. Cannont be used with --start, --end, or --step. Can be a unix timestamp or RFC3339.",
-						"-start": "Start time for a range query. Cannont be used with --time. Can be a unix timestamp or RFC3339.",
-						"-end":   "End time for a range query. Cannont be used with --time. Can be a unix timestamp or RFC3339.",
-						"-step":  "Step interval for a range query. Cannot be used with --time.",
+						"-time":            "Effective time for query execution of an instant query. Cannont be used with --start, --end, or --step. Can be UNIX seconds (cf tail takes nanoseconds), RFC3339, 'now', or relative to now such as '-1h'.",
+						"-start":           "Start time for a range query. Cannont be used with --time. Can be UNIX seconds (cf tail takes nanoseconds), RFC3339, 'now', or relative to now such as '-1h'.",
+						"-end":             "End time for a range query. Cannont be used with --time. Can be UNIX seconds (cf tail takes nanoseconds), RFC3339, 'now', or relative to now such as '-1h'.",
+						"-step":            "Step interval for a range query. Cannot be used with --time.",
+						"-watch":           "Issue an instant query again every interval, such as '10s', until interrupted. On a terminal each result replaces the last with the values that changed highlighted, otherwise each result is written after the last with the time it was issued. Cannot be used with --time.",
+						"-chart":           "Draw a chart of each series of a range query, scaled to the width of the terminal. Cannot be used with --output.",
+						"-assert":          "Condition the value of each series of an instant query must meet, such as '< 0.05'. Can be given more than once. Exits with 2 if the query fails, 3 if the condition is not met and 4 if there is no data.",
+						"-assert-mode":     "Whether 'all' series or 'any' series must meet the --assert conditions. Default is 'all'.",
+						"-relabel-sources": "Replace the GUIDs in the source_id labels of the result with the names of the apps and services given in the query, such as source_id='app:my-app' or {{app \"my-app\"}}.",
+						"-output":          "Format of the result: 'table', 'long' or 'json'. Tables have a row for each series, with a column for each step of a range query, or a row for each value with 'long'. Default is 'table' on a terminal and 'json' otherwise.",
 					},
 				},
 			},
@@ -1,7 +1,16 @@
 // Package http provides HTTP client implementations.
 package http
 
-import "net/http"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
 
 // A Client is implemented by the standard library's http.Client and
 // TokenClient.
@@ -9,30 +18,185 @@ type Client interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
+// A Logger is used by TokenClient to report problems that it recovers from.
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
 // A TokenClient wraps an HTTP client to automatically set Authorization headers
 // in requests using the provided function to generate tokens.
+//
+// Tokens are cached until shortly before they expire. The expiry is read from
+// the exp claim of JWT tokens, and other tokens are refreshed every refresh
+// interval. If the server rejects a token, the request is retried once with a
+// fresh token. A TokenClient is safe for concurrent use.
 type TokenClient struct {
-	c         Client
-	tokenFunc func() string
+	c               Client
+	tokenFunc       func() (string, error)
+	refreshInterval time.Duration
+	refreshMargin   time.Duration
+	log             Logger
+
+	mu        sync.Mutex
+	token     string
+	refreshAt time.Time
+	expiresAt time.Time
+}
+
+// TokenClientOption configures a TokenClient.
+type TokenClientOption func(*TokenClient)
+
+// WithTokenRefreshInterval sets how often tokens without an expiry are
+// refreshed. It defaults to 5 minutes.
+func WithTokenRefreshInterval(d time.Duration) TokenClientOption {
+	return func(c *TokenClient) {
+		c.refreshInterval = d
+	}
+}
+
+// WithTokenRefreshMargin sets how long before they expire tokens are
+// refreshed. It defaults to 1 minute.
+func WithTokenRefreshMargin(d time.Duration) TokenClientOption {
+	return func(c *TokenClient) {
+		c.refreshMargin = d
+	}
+}
+
+// WithTokenLogger sets the logger used to report failures to refresh a token.
+// By default they are not reported.
+func WithTokenLogger(l Logger) TokenClientOption {
+	return func(c *TokenClient) {
+		c.log = l
+	}
 }
 
 // NewTokenClient returns a TokenClient given a client and token-generating
 // funtion.
-func NewTokenClient(c Client, tf func() string) *TokenClient {
-	return &TokenClient{
-		c:         c,
-		tokenFunc: tf,
+func NewTokenClient(c Client, tf func() (string, error), opts ...TokenClientOption) *TokenClient {
+	tc := &TokenClient{
+		c:               c,
+		tokenFunc:       tf,
+		refreshInterval: 5 * time.Minute,
+		refreshMargin:   time.Minute,
+		log:             discardLogger{},
 	}
+
+	for _, o := range opts {
+		o(tc)
+	}
+
+	return tc
 }
 
 // Do makes an HTTP request using the underlying client. If the token function
 // returns a non-empty string then it will be set as the Authorization header of
-// the request.
+// the request. If the response is 401 Unauthorized, the request is retried
+// once with a fresh token.
 func (c *TokenClient) Do(req *http.Request) (*http.Response, error) {
-	accessToken := c.tokenFunc()
-	if len(accessToken) > 0 {
-		req.Header.Set("Authorization", accessToken)
+	token, err := c.accessToken(false)
+	if err != nil {
+		return nil, err
+	}
+	setAuthorization(req, token)
+
+	resp, err := c.c.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if req.Body != nil && req.GetBody == nil {
+		// The request body has been read and cannot be sent again.
+		return resp, nil
+	}
+
+	fresh, err := c.accessToken(true)
+	if err != nil || fresh == token {
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+	}
+	setAuthorization(retry, fresh)
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+
+	return c.c.Do(retry)
+}
+
+// accessToken returns the cached token, refreshing it first if it is due to
+// be refreshed or force is set. If refreshing fails while the cached token
+// has not expired, the cached token is returned. Every failure to refresh is
+// reported to the logger, as callers such as logcache.Walk may retry without
+// reporting the error they are returned.
+func (c *TokenClient) accessToken(force bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !force && c.token != "" && now.Before(c.refreshAt) {
+		return c.token, nil
+	}
+
+	token, err := c.tokenFunc()
+	if err != nil {
+		if c.token != "" && now.Before(c.expiresAt) {
+			c.log.Printf("Failed to refresh access token, the current token will be used until it expires: %s", err)
+			return c.token, nil
+		}
+		c.log.Printf("Failed to refresh access token: %s", err)
+		return "", fmt.Errorf("unable to get access token: %s", err)
 	}
 
-	return c.c.Do(req)
+	c.token = token
+	c.expiresAt = now.Add(c.refreshInterval)
+	c.refreshAt = c.expiresAt
+	if exp, ok := tokenExpiry(token); ok {
+		c.expiresAt = exp
+		c.refreshAt = exp.Add(-c.refreshMargin)
+	}
+
+	return c.token, nil
+}
+
+func setAuthorization(req *http.Request, token string) {
+	if len(token) > 0 {
+		req.Header.Set("Authorization", token)
+	}
 }
+
+// tokenExpiry returns the time given by the exp claim of a JWT token, which
+// may be prefixed with its type, e.g. "bearer".
+func tokenExpiry(token string) (time.Time, bool) {
+	if i := strings.LastIndex(token, " "); i >= 0 {
+		token = token[i+1:]
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(*claims.Exp), 0), true
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(string, ...any) {}
@@ -1,14 +1,20 @@
 package http
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestTokenClient(t *testing.T) {
 	mc := &mockClient{}
-	tc := NewTokenClient(mc, func() string {
-		return "test"
+	tc := NewTokenClient(mc, func() (string, error) {
+		return "test", nil
 	})
 
 	r, err := http.NewRequest("GET", "fakeurl", nil)
@@ -31,11 +37,262 @@ func TestTokenClient(t *testing.T) {
 	}
 }
 
+func TestTokenClientCachesToken(t *testing.T) {
+	mc := &mockClient{}
+	tokens := &mockTokens{tokens: []string{jwt(time.Now().Add(time.Hour))}}
+	tc := NewTokenClient(mc, tokens.next)
+
+	doRequests(t, tc, 3)
+
+	if tokens.calls != 1 {
+		t.Errorf("got %d token requests, want %d", tokens.calls, 1)
+	}
+}
+
+func TestTokenClientRefreshesTokenBeforeExpiry(t *testing.T) {
+	mc := &mockClient{}
+	tokens := &mockTokens{tokens: []string{
+		jwt(time.Now().Add(30 * time.Second)),
+		jwt(time.Now().Add(time.Hour)),
+	}}
+	tc := NewTokenClient(mc, tokens.next)
+
+	doRequests(t, tc, 3)
+
+	if tokens.calls != 2 {
+		t.Errorf("got %d token requests, want %d", tokens.calls, 2)
+	}
+
+	auth := mc.lastReq.Header.Get("Authorization")
+	if auth != tokens.tokens[1] {
+		t.Errorf("got %s, want %s", auth, tokens.tokens[1])
+	}
+}
+
+func TestTokenClientRefreshesOpaqueTokensEveryInterval(t *testing.T) {
+	mc := &mockClient{}
+	tokens := &mockTokens{tokens: []string{"bearer opaque"}}
+	tc := NewTokenClient(mc, tokens.next, WithTokenRefreshInterval(0))
+
+	doRequests(t, tc, 2)
+
+	if tokens.calls != 2 {
+		t.Errorf("got %d token requests, want %d", tokens.calls, 2)
+	}
+}
+
+func TestTokenClientRetriesUnauthorizedRequestWithFreshToken(t *testing.T) {
+	mc := &mockClient{statusCodes: []int{http.StatusUnauthorized}}
+	tokens := &mockTokens{tokens: []string{"bearer revoked", "bearer fresh"}}
+	tc := NewTokenClient(mc, tokens.next)
+
+	r, err := http.NewRequest("POST", "fakeurl", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := tc.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != 200 {
+		t.Errorf("got %d, want %d", resp.StatusCode, 200)
+	}
+
+	if len(mc.requests) != 2 {
+		t.Fatalf("got %d requests, want %d", len(mc.requests), 2)
+	}
+
+	auth := mc.requests[1].Header.Get("Authorization")
+	if auth != "bearer fresh" {
+		t.Errorf("got %s, want %s", auth, "bearer fresh")
+	}
+
+	if mc.bodies[1] != "body" {
+		t.Errorf("got body %q, want %q", mc.bodies[1], "body")
+	}
+}
+
+func TestTokenClientDoesNotRetryWithSameToken(t *testing.T) {
+	mc := &mockClient{statusCodes: []int{http.StatusUnauthorized}}
+	tokens := &mockTokens{tokens: []string{"bearer same"}}
+	tc := NewTokenClient(mc, tokens.next)
+
+	resp := doRequests(t, tc, 1)
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	if len(mc.requests) != 1 {
+		t.Errorf("got %d requests, want %d", len(mc.requests), 1)
+	}
+}
+
+func TestTokenClientUsesCurrentTokenWhenRefreshFails(t *testing.T) {
+	mc := &mockClient{}
+	current := jwt(time.Now().Add(30 * time.Second))
+	tokens := &mockTokens{
+		tokens: []string{current},
+		errs:   []error{nil, errors.New("network unreachable")},
+	}
+	l := &mockLogger{}
+	tc := NewTokenClient(mc, tokens.next, WithTokenLogger(l))
+
+	doRequests(t, tc, 2)
+
+	auth := mc.lastReq.Header.Get("Authorization")
+	if auth != current {
+		t.Errorf("got %s, want %s", auth, current)
+	}
+
+	if len(l.messages) != 1 || !strings.Contains(l.messages[0], "network unreachable") {
+		t.Errorf("got messages %v, want a message about the failed refresh", l.messages)
+	}
+}
+
+func TestTokenClientReportsRefreshFailuresAfterExpiry(t *testing.T) {
+	mc := &mockClient{}
+	tokens := &mockTokens{
+		tokens: []string{jwt(time.Now().Add(-time.Second))},
+		errs:   []error{nil, errors.New("network unreachable"), errors.New("network unreachable")},
+	}
+	l := &mockLogger{}
+	tc := NewTokenClient(mc, tokens.next, WithTokenLogger(l))
+
+	doRequests(t, tc, 1)
+
+	for i := 0; i < 2; i++ {
+		r, err := http.NewRequest("GET", "fakeurl", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tc.Do(r)
+		if err == nil || err.Error() != "unable to get access token: network unreachable" {
+			t.Errorf("got error %v, want %q", err, "unable to get access token: network unreachable")
+		}
+	}
+
+	want := []string{
+		"Failed to refresh access token: network unreachable",
+		"Failed to refresh access token: network unreachable",
+	}
+	if strings.Join(l.messages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got messages %v, want %v", l.messages, want)
+	}
+
+	if len(mc.requests) != 1 {
+		t.Errorf("got %d requests, want %d", len(mc.requests), 1)
+	}
+}
+
+func TestTokenClientReturnsErrorWhenNoTokenIsAvailable(t *testing.T) {
+	mc := &mockClient{}
+	tokens := &mockTokens{errs: []error{errors.New("not logged in")}}
+	tc := NewTokenClient(mc, tokens.next)
+
+	r, err := http.NewRequest("GET", "fakeurl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = tc.Do(r)
+	if err == nil || err.Error() != "unable to get access token: not logged in" {
+		t.Errorf("got error %v, want %q", err, "unable to get access token: not logged in")
+	}
+
+	if len(mc.requests) != 0 {
+		t.Errorf("got %d requests, want %d", len(mc.requests), 0)
+	}
+}
+
+func doRequests(t *testing.T, tc *TokenClient, n int) *http.Response {
+	t.Helper()
+
+	var resp *http.Response
+	for i := 0; i < n; i++ {
+		r, err := http.NewRequest("GET", "fakeurl", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err = tc.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func jwt(exp time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return fmt.Sprintf("bearer %s.%s.%s",
+		encode([]byte(`{"alg":"RS256"}`)),
+		encode([]byte(fmt.Sprintf(`{"exp":%d}`, exp.Unix()))),
+		encode([]byte("signature")),
+	)
+}
+
 type mockClient struct {
-	lastReq http.Request
+	lastReq     http.Request
+	requests    []*http.Request
+	bodies      []string
+	statusCodes []int
 }
 
 func (c *mockClient) Do(req *http.Request) (*http.Response, error) {
 	c.lastReq = *req
-	return &http.Response{StatusCode: 200}, nil
+	c.requests = append(c.requests, req)
+
+	var body string
+	if req.Body != nil {
+		b, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = string(b)
+	}
+	c.bodies = append(c.bodies, body)
+
+	statusCode := 200
+	if len(c.statusCodes) > 0 {
+		statusCode = c.statusCodes[0]
+		c.statusCodes = c.statusCodes[1:]
+	}
+
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader("")),
+	}, nil
+}
+
+// mockTokens returns each of its tokens and errors in turn, repeating the
+// last token once they run out.
+type mockTokens struct {
+	tokens []string
+	errs   []error
+	calls  int
+}
+
+func (m *mockTokens) next() (string, error) {
+	defer func() { m.calls++ }()
+
+	if m.calls < len(m.errs) && m.errs[m.calls] != nil {
+		return "", m.errs[m.calls]
+	}
+
+	if len(m.tokens) == 0 {
+		return "", nil
+	}
+	return m.tokens[min(m.calls, len(m.tokens)-1)], nil
+}
+
+type mockLogger struct {
+	messages []string
+}
+
+func (l *mockLogger) Printf(format string, args ...any) {
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
 }